@@ -0,0 +1,66 @@
+package main
+
+import (
+    "strings"
+    "time"
+    "github.com/StephensAndrewM/FlightFinder/refdata"
+)
+
+// Runs saved before the marketing carrier was kept only have the flight
+//     number, e.g. UA 1234
+func (segment FlightsResultSegment) GetCarrierCode() string {
+    if len(segment.MarketingCarrier) > 0 {
+        return segment.MarketingCarrier
+    }
+    return strings.Split(segment.FlightNumber, " ")[0]
+}
+
+// The airline actually flying the segment, if it's in the airline database
+func (segment FlightsResultSegment) GetOperatingCarrierCode() string {
+    if len(segment.OperatingCarrier) > 0 {
+        return segment.OperatingCarrierCode
+    }
+    return segment.GetCarrierCode()
+}
+
+/**
+ * Whether a list of airlines names the carrier, by IATA code, ICAO code or
+ *     the alliance it belongs to (e.g. "Star Alliance").
+ */
+func AirlineListMatches(list []string, code string) bool {
+    airline, known := refdata.LookupAirline(code)
+    for _,entry := range list {
+        if strings.EqualFold(entry, code) {
+            return true
+        }
+        if known && (strings.EqualFold(entry, airline.ICAO) ||
+            (len(airline.Alliance) > 0 && strings.EqualFold(entry, airline.Alliance))) {
+            return true
+        }
+    }
+    return false
+}
+
+// City names for a route, e.g. "San Francisco -> Boston", if both are known
+func DescribeCities(origin string, destination string) string {
+    from, fromOk := refdata.LookupAirport(origin)
+    to, toOk := refdata.LookupAirport(destination)
+    if !fromOk || !toOk {
+        return ""
+    }
+    return from.City + " -> " + to.City
+}
+
+/**
+ * QPX times only carry a UTC offset, so they print as e.g. -0700. Shown in the
+ *     airport's own time zone they get a name like PDT instead. Otherwise the
+ *     QPX offset is kept.
+ */
+func InAirportTime(t time.Time, code string) time.Time {
+    if airport, ok := refdata.LookupAirport(code); ok {
+        if loc, ok := airport.GetLocation(); ok {
+            return t.In(loc)
+        }
+    }
+    return t
+}
@@ -0,0 +1,86 @@
+package main
+
+/**
+ * What a carrier charges each passenger, each way. Checked holds the fee for
+ *     the first bag, the second, and so on; the last entry repeats for any
+ *     more bags than that.
+ */
+type CarrierBagFees struct {
+    CarryOn float64
+    Checked []float64
+}
+
+// Approximate published fees for paid bags, by marketing carrier code.
+//     Update these when the airlines change them.
+var CARRIER_BAG_FEES = map[string]CarrierBagFees{
+    "AA": { CarryOn: 0,  Checked: []float64{ 25, 35, 150 } },
+    "AS": { CarryOn: 0,  Checked: []float64{ 25, 25, 75 } },
+    "B6": { CarryOn: 0,  Checked: []float64{ 25, 35, 100 } },
+    "DL": { CarryOn: 0,  Checked: []float64{ 25, 35, 150 } },
+    "F9": { CarryOn: 35, Checked: []float64{ 30, 40, 75 } },
+    "HA": { CarryOn: 0,  Checked: []float64{ 25, 35, 100 } },
+    "NK": { CarryOn: 35, Checked: []float64{ 30, 40, 75 } },
+    "UA": { CarryOn: 0,  Checked: []float64{ 25, 35, 150 } },
+    "VX": { CarryOn: 0,  Checked: []float64{ 25, 25, 25 } },
+    "WN": { CarryOn: 0,  Checked: []float64{ 0, 0, 75 } },
+}
+
+// Used for carriers missing from the table
+var DEFAULT_BAG_FEES = CarrierBagFees{ CarryOn: 0, Checked: []float64{ 25, 35, 100 } }
+
+func GetCarrierBagFees(carrierCode string) CarrierBagFees {
+    if fees, ok := CARRIER_BAG_FEES[carrierCode]; ok {
+        return fees
+    }
+    return DEFAULT_BAG_FEES
+}
+
+/**
+ * Fee for one passenger's bags on one slice, after the free allowance.
+ */
+func (fees CarrierBagFees) GetFee(checkedBags int, carryOnBags int,
+    freeBags int) (fee float64) {
+
+    fee += fees.CarryOn * float64(carryOnBags)
+    for bag := freeBags; bag < checkedBags; bag++ {
+        if len(fees.Checked) > 0 {
+            fee += fees.Checked[Min(bag, len(fees.Checked)-1)]
+        }
+    }
+    return
+
+}
+
+/**
+ * Add what the bags in the request would cost to each option. Each slice is
+ *     charged at the rates of the carrier selling its first flight. Options
+ *     without a known baggage allowance are assumed to include no bags.
+ */
+func (res *FlightsResult) ApplyBagFees(req FlightsRequest) {
+
+    for i := range res.Options {
+        option := &res.Options[i]
+        option.BagFees = 0
+        for _,slice := range option.Slices {
+            if len(slice.Segments) == 0 {
+                continue
+            }
+            fees := GetCarrierBagFees(slice.Segments[0].GetCarrierCode())
+            option.BagFees += fees.GetFee(req.CheckedBags, req.CarryOnBags,
+                option.Fare.FreeBags) * float64(req.NumPassengers)
+        }
+        option.EffectivePrice = option.Price + option.BagFees
+    }
+
+}
+
+/**
+ * The price including bag fees. Options saved before bag fees were worked
+ *     out only have the fare.
+ */
+func (option FlightsResultOption) GetEffectivePrice() float64 {
+    if option.EffectivePrice > 0 {
+        return option.EffectivePrice
+    }
+    return option.Price
+}
@@ -0,0 +1,551 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "io"
+    "os"
+    "os/exec"
+    "os/signal"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+    "unicode/utf8"
+)
+
+const (
+    SORT_PRICE     = "price"
+    SORT_DURATION  = "duration"
+    SORT_STOPS     = "stops"
+    SORT_DEPARTURE = "departure"
+)
+
+var BROWSE_SORTS = []string{ SORT_PRICE, SORT_DURATION, SORT_STOPS, SORT_DEPARTURE }
+
+// Terminal control sequences
+const (
+    TERM_ALT_SCREEN  = "\x1b[?1049h\x1b[?25l"
+    TERM_MAIN_SCREEN = "\x1b[?25h\x1b[?1049l"
+    TERM_CLEAR       = "\x1b[H\x1b[2J"
+    TERM_REVERSE     = "\x1b[7m"
+    TERM_RESET       = "\x1b[0m"
+)
+
+// Keys that arrive as escape sequences, mapped to single bytes
+const (
+    KEY_UP        = 'k'
+    KEY_DOWN      = 'j'
+    KEY_PAGE_UP   = 'K'
+    KEY_PAGE_DOWN = 'J'
+    KEY_ENTER     = '\r'
+)
+
+/**
+ * Interactive browser over every option from a search, for a terminal.
+ *     Everything happens on the options already fetched; no requests are made.
+ */
+type BrowserRenderer struct {}
+
+type Browser struct {
+    All FlightsResultOptionList
+    View FlightsResultOptionList
+    Summary SearchSummary
+
+    Sort string
+    Airline string
+    Airport string
+    MaxStops int // Per direction, -1 for any
+
+    Cursor int
+    Offset int
+    Expanded bool
+    Rows int
+    Cols int
+}
+
+func (r BrowserRenderer) Render(w io.Writer, summary SearchSummary,
+    optionsList FlightsResultOptionList) error {
+
+    restore, err := StartRawTerminal()
+    if err != nil {
+        return fmt.Errorf("interactive output needs a terminal: %s", err)
+    }
+    defer restore()
+
+    // Put the terminal back if we're interrupted
+    interrupts := make(chan os.Signal, 1)
+    signal.Notify(interrupts, os.Interrupt)
+    defer signal.Stop(interrupts)
+    go func() {
+        if _, ok := <-interrupts; ok {
+            restore()
+            fmt.Fprint(w, TERM_MAIN_SCREEN)
+            os.Exit(1)
+        }
+    }()
+
+    browser := NewBrowser(summary, optionsList)
+    browser.Rows, browser.Cols = GetTerminalSize()
+
+    fmt.Fprint(w, TERM_ALT_SCREEN)
+    defer fmt.Fprint(w, TERM_MAIN_SCREEN)
+    return browser.Run(bufio.NewReader(os.Stdin), w)
+
+}
+
+func NewBrowser(summary SearchSummary, optionsList FlightsResultOptionList) (
+    *Browser) {
+
+    browser := &Browser{
+        All: optionsList,
+        Summary: summary,
+        Sort: SORT_PRICE,
+        MaxStops: -1,
+        Rows: 24,
+        Cols: 80,
+    }
+    browser.Update()
+    return browser
+
+}
+
+/**
+ * Read keys and redraw until the user quits.
+ *     Up/down or j/k move, PgUp/PgDn or J/K page, Enter expands an option,
+ *     s changes the sort, a/p/m filter by airline, airport and max stops,
+ *     c clears filters and q quits.
+ */
+func (b *Browser) Run(in *bufio.Reader, w io.Writer) error {
+
+    for {
+        if err := b.Draw(w); err != nil {
+            return err
+        }
+        key, err := ReadKey(in)
+        if err != nil {
+            return err
+        }
+
+        switch key {
+        case 'q':
+            return nil
+        case KEY_UP:
+            b.Move(-1)
+        case KEY_DOWN:
+            b.Move(1)
+        case KEY_PAGE_UP:
+            b.Move(-b.GetPageSize())
+        case KEY_PAGE_DOWN:
+            b.Move(b.GetPageSize())
+        case KEY_ENTER, ' ':
+            b.Expanded = !b.Expanded && len(b.View) > 0
+        case 's':
+            b.Sort = NextSort(b.Sort)
+            b.Update()
+        case 'a':
+            b.Airline = strings.ToUpper(b.Prompt(in, w, "Airline code or name (blank for any): "))
+            b.Update()
+        case 'p':
+            b.Airport = strings.ToUpper(b.Prompt(in, w, "Airport (blank for any): "))
+            b.Update()
+        case 'm':
+            b.MaxStops = -1
+            if stops, err := strconv.Atoi(b.Prompt(in, w,
+                "Max stops each way (blank for any): ")); err == nil && stops >= 0 {
+                b.MaxStops = stops
+            }
+            b.Update()
+        case 'c':
+            b.Airline, b.Airport, b.MaxStops = "", "", -1
+            b.Update()
+        }
+    }
+
+}
+
+/**
+ * Re-apply the filters and sort, keeping the cursor in range.
+ */
+func (b *Browser) Update() {
+
+    b.View = nil
+    for _,option := range b.All {
+        if b.Matches(option) {
+            b.View = append(b.View, option)
+        }
+    }
+    sort.SliceStable(b.View, GetOptionLess(b.View, b.Sort))
+
+    b.Cursor, b.Offset = 0, 0
+    b.Expanded = false
+
+}
+
+/**
+ * Whether an option passes the filters. The airline filter takes a carrier
+ *     code, marketing or operating, or the airline's full name.
+ */
+func (b *Browser) Matches(option FlightsResultOption) bool {
+
+    airlineFound := len(b.Airline) == 0
+    airportFound := len(b.Airport) == 0
+    for _,slice := range option.Slices {
+        if b.MaxStops >= 0 && slice.GetStops() > b.MaxStops {
+            return false
+        }
+        for _,segment := range slice.Segments {
+            if b.MatchesAirline(segment) {
+                airlineFound = true
+            }
+            if segment.Origin == b.Airport || segment.Destination == b.Airport {
+                airportFound = true
+            }
+        }
+    }
+    return airlineFound && airportFound
+
+}
+
+func (b *Browser) MatchesAirline(segment FlightsResultSegment) bool {
+    filter := []string{ b.Airline }
+    return AirlineListMatches(filter, segment.GetCarrierCode()) ||
+        AirlineListMatches(filter, segment.GetOperatingCarrierCode()) ||
+        strings.EqualFold(segment.Airline, b.Airline)
+}
+
+func (b *Browser) Move(delta int) {
+
+    b.Cursor += delta
+    if b.Cursor >= len(b.View) {
+        b.Cursor = len(b.View) - 1
+    }
+    if b.Cursor < 0 {
+        b.Cursor = 0
+    }
+
+    // Keep the cursor on screen
+    if b.Cursor < b.Offset {
+        b.Offset = b.Cursor
+    }
+    if b.Cursor >= b.Offset + b.GetPageSize() {
+        b.Offset = b.Cursor - b.GetPageSize() + 1
+    }
+
+}
+
+// Options that fit between the header and footer, two lines each
+func (b *Browser) GetPageSize() int {
+    size := (b.Rows - 4) / 2
+    if size < 1 {
+        return 1
+    }
+    return size
+}
+
+func (b *Browser) Draw(w io.Writer) error {
+
+    buf := new(bytes.Buffer)
+    buf.WriteString(TERM_CLEAR)
+
+    var warnings string
+    if len(b.Summary.Warnings) > 0 {
+        warnings = fmt.Sprintf(", %d warnings", len(b.Summary.Warnings))
+    }
+    fmt.Fprintf(buf, "%d of %d options (%d/%d queries succeeded%s)  sort: %s%s\r\n",
+        len(b.View), len(b.All), b.Summary.Successes,
+        b.Summary.AttemptedRequests, warnings, b.Sort, b.DescribeFilters())
+    buf.WriteString(RepeatChar("-", b.Cols) + "\r\n")
+
+    if b.Expanded {
+        b.DrawOption(buf)
+    } else {
+        b.DrawList(buf)
+    }
+
+    fmt.Fprintf(buf, "\x1b[%d;1H", b.Rows)
+    buf.WriteString(TruncateLine("j/k move  enter details  s sort  " +
+        "a/p/m airline/airport/stops  c clear  q quit", b.Cols))
+
+    _, err := buf.WriteTo(w)
+    return err
+
+}
+
+func (b *Browser) DrawList(buf *bytes.Buffer) {
+
+    if len(b.View) == 0 {
+        buf.WriteString("No options match the filters\r\n")
+        return
+    }
+
+    end := Min(len(b.View), b.Offset + b.GetPageSize())
+    for i := b.Offset; i < end; i++ {
+        option := b.View[i]
+        lines := []string{
+            fmt.Sprintf("%4d  %9s  Out: %s", i+1,
+                fmt.Sprintf("$%.2f", option.GetEffectivePrice()),
+                DescribeSlice(option.Slices[0])),
+            fmt.Sprintf("%4s  %9s  In:  %s", "", "", DescribeSlice(option.Slices[1])),
+        }
+        for _,line := range lines {
+            line = TruncateLine(line, b.Cols)
+            if i == b.Cursor {
+                line = TERM_REVERSE + line + RepeatChar(" ", b.Cols - utf8.RuneCountInString(line)) +
+                    TERM_RESET
+            }
+            buf.WriteString(line + "\r\n")
+        }
+    }
+
+}
+
+/**
+ * The selected option in the card layout, with the layovers between flights.
+ */
+func (b *Browser) DrawOption(buf *bytes.Buffer) {
+
+    option := b.View[b.Cursor]
+    card := new(bytes.Buffer)
+    fmt.Fprintf(card, "Option %d of %d\n", b.Cursor+1, len(b.View))
+    fmt.Fprintf(card, "Cost:       $%.2f\n", option.Price)
+    if option.BagFees > 0 {
+        fmt.Fprintf(card, "With Bags:  %s\n", DescribeBagFees(option))
+    }
+    PrintFare(card, option)
+    for i,slice := range option.Slices {
+        fmt.Fprintln(card, RepeatChar("-", CARD_WIDTH))
+        if i == 0 {
+            fmt.Fprintf(card, "Outbound:   ")
+        } else {
+            fmt.Fprintf(card, "Inbound:    ")
+        }
+        PrintSlice(card, slice)
+        fmt.Fprintf(card, "Duration:   %s, %s\n", FormatDuration(slice.Duration),
+            DescribeStops(slice.GetStops()))
+        if layovers := DescribeLayovers(slice); len(layovers) > 0 {
+            fmt.Fprintf(card, "Layovers:   %s\n", layovers)
+        }
+        for _,segment := range slice.Segments {
+            for _,leg := range segment.Legs {
+                fmt.Fprintf(card, "Leg:        %s\n", DescribeLeg(leg))
+            }
+        }
+    }
+
+    lines := strings.Split(strings.TrimRight(card.String(), "\n"), "\n")
+    for _,line := range lines[:Min(len(lines), b.Rows - 3)] {
+        buf.WriteString(line + "\r\n")
+    }
+
+}
+
+func (b *Browser) DescribeFilters() string {
+    var filters []string
+    if len(b.Airline) > 0 {
+        filters = append(filters, "airline " + b.Airline)
+    }
+    if len(b.Airport) > 0 {
+        filters = append(filters, "airport " + b.Airport)
+    }
+    if b.MaxStops >= 0 {
+        filters = append(filters, fmt.Sprintf("max %d stops", b.MaxStops))
+    }
+    if len(filters) == 0 {
+        return ""
+    }
+    return "  filters: " + strings.Join(filters, ", ")
+}
+
+/**
+ * Ask for a line of text on the bottom row. Echo is off, so typed characters
+ *     are drawn here.
+ */
+func (b *Browser) Prompt(in *bufio.Reader, w io.Writer, label string) string {
+
+    var text []byte
+    for {
+        fmt.Fprintf(w, "\x1b[%d;1H\x1b[2K%s%s", b.Rows, label, text)
+        c, err := in.ReadByte()
+        if err != nil {
+            return ""
+        }
+        switch {
+        case c == '\r' || c == '\n':
+            return strings.TrimSpace(string(text))
+        case c == 0x7f || c == '\b':
+            if len(text) > 0 {
+                text = text[:len(text)-1]
+            }
+        case c == 0x1b:
+            return ""
+        case c >= ' ' && c < 0x7f:
+            text = append(text, c)
+        }
+    }
+
+}
+
+// Expected Output Format: 1h20m ORD, 0h55m DEN
+func DescribeLayovers(slice FlightsResultSlice) string {
+    var layovers []string
+    for i := 1; i < len(slice.Segments); i++ {
+        wait := slice.Segments[i].DepartureTime.Sub(slice.Segments[i-1].ArrivalTime)
+        layovers = append(layovers, FormatDuration(wait) + " " +
+            slice.Segments[i].Origin)
+    }
+    return strings.Join(layovers, ", ")
+}
+
+// Expected Output Format: SFO T2 -> DEN B, 2h30m, Boeing 737, 85% on time
+func DescribeLeg(leg FlightsResultLeg) string {
+    origin := strings.TrimSpace(leg.Origin + " " + leg.OriginTerminal)
+    destination := strings.TrimSpace(leg.Destination + " " + leg.DestinationTerminal)
+    details := []string{ origin + " -> " + destination, FormatDuration(leg.Duration) }
+    if len(leg.Aircraft) > 0 {
+        details = append(details, leg.Aircraft)
+    }
+    if leg.OnTimePerformance > 0 {
+        details = append(details, fmt.Sprintf("%d%% on time", leg.OnTimePerformance))
+    }
+    if len(leg.Meal) > 0 {
+        details = append(details, leg.Meal)
+    }
+    if len(leg.OperatingCarrier) > 0 {
+        details = append(details, "operated by " + leg.OperatingCarrier)
+    }
+    return strings.Join(details, ", ")
+}
+
+func GetOptionLess(options FlightsResultOptionList, sortBy string) (
+    func(i, j int) bool) {
+
+    return func(i, j int) bool {
+        a, b := options[i], options[j]
+        switch sortBy {
+        case SORT_DURATION:
+            return a.GetDuration() < b.GetDuration()
+        case SORT_STOPS:
+            return a.GetStops() < b.GetStops()
+        case SORT_DEPARTURE:
+            return a.GetDepartureTime().Before(b.GetDepartureTime())
+        default:
+            return a.GetEffectivePrice() < b.GetEffectivePrice()
+        }
+    }
+
+}
+
+func NextSort(sortBy string) string {
+    for i,s := range BROWSE_SORTS {
+        if s == sortBy {
+            return BROWSE_SORTS[(i+1) % len(BROWSE_SORTS)]
+        }
+    }
+    return SORT_PRICE
+}
+
+func (option FlightsResultOption) GetDuration() (duration time.Duration) {
+    for _,slice := range option.Slices {
+        duration += slice.Duration
+    }
+    return
+}
+
+func (option FlightsResultOption) GetStops() (stops int) {
+    for _,slice := range option.Slices {
+        stops += slice.GetStops()
+    }
+    return
+}
+
+func (option FlightsResultOption) GetDepartureTime() time.Time {
+    if len(option.Slices[0].Segments) == 0 {
+        return time.Time{}
+    }
+    return option.Slices[0].Segments[0].DepartureTime
+}
+
+// Cut by characters, not bytes, so airline and city names don't get split
+//     partway through a character
+func TruncateLine(line string, width int) string {
+    if utf8.RuneCountInString(line) <= width {
+        return line
+    }
+    if width <= 0 {
+        return ""
+    }
+    return string([]rune(line)[:width])
+}
+
+/**
+ * Read one key press. Arrow and page keys arrive as escape sequences and are
+ *     translated to the matching vi-style key.
+ */
+func ReadKey(in *bufio.Reader) (byte, error) {
+
+    c, err := in.ReadByte()
+    if err != nil || c != 0x1b {
+        return c, err
+    }
+    if next, err := in.ReadByte(); err != nil || next != '[' {
+        return 0, err
+    }
+    c, err = in.ReadByte()
+    if err != nil {
+        return 0, err
+    }
+    switch c {
+    case 'A':
+        return KEY_UP, nil
+    case 'B':
+        return KEY_DOWN, nil
+    case '5', '6':
+        in.ReadByte() // Trailing ~
+        if c == '5' {
+            return KEY_PAGE_UP, nil
+        }
+        return KEY_PAGE_DOWN, nil
+    }
+    return 0, nil
+
+}
+
+/**
+ * Switch the terminal on stdin to read single unechoed key presses, using
+ *     stty rather than a terminal library. Returns a function that puts the
+ *     previous settings back.
+ */
+func StartRawTerminal() (restore func(), err error) {
+
+    saved, err := RunStty("-g")
+    if err != nil {
+        return
+    }
+    if _, err = RunStty("-icanon", "-echo", "-icrnl", "min", "1", "time", "0"); err != nil {
+        return
+    }
+    restore = func() {
+        RunStty(strings.TrimSpace(saved))
+    }
+    return
+
+}
+
+func GetTerminalSize() (rows int, cols int) {
+    rows, cols = 24, 80
+    size, err := RunStty("size")
+    if err != nil {
+        return
+    }
+    fmt.Sscan(size, &rows, &cols)
+    return
+}
+
+func RunStty(args ...string) (string, error) {
+    cmd := exec.Command("stty", args...)
+    cmd.Stdin = os.Stdin
+    out, err := cmd.Output()
+    return string(out), err
+}
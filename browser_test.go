@@ -0,0 +1,148 @@
+package main
+
+import (
+    "testing"
+)
+
+// A one-segment-each-way option, with the outbound segment as given
+func BrowserTestOption(price float64, outbound FlightsResultSegment) (
+    option FlightsResultOption) {
+
+    outbound.NumLegs = 1
+    inbound := FlightsResultSegment{
+        Airline: "JetBlue Airways",
+        MarketingCarrier: "B6",
+        FlightNumber: "B6 434",
+        Origin: "BOS",
+        Destination: "SFO",
+        NumLegs: 1,
+    }
+    option.Price = price
+    option.Slices[0].Segments = []FlightsResultSegment{ outbound }
+    option.Slices[1].Segments = []FlightsResultSegment{ inbound }
+    return
+
+}
+
+func GetBrowserTestOptions() FlightsResultOptionList {
+    return FlightsResultOptionList{
+        BrowserTestOption(300, FlightsResultSegment{
+            Airline: "United Airlines, Inc.",
+            MarketingCarrier: "UA",
+            OperatingCarrier: "SKYWEST DBA UNITED EXPRESS",
+            OperatingCarrierCode: "OO",
+            FlightNumber: "UA 100",
+            Origin: "SFO",
+            Destination: "DEN",
+        }),
+        BrowserTestOption(200, FlightsResultSegment{
+            Airline: "Alaska Airlines, Inc.",
+            MarketingCarrier: "AS",
+            FlightNumber: "AS 12",
+            Origin: "OAK",
+            Destination: "BOS",
+        }),
+    }
+}
+
+func TestBrowserMatchesAirline(t *testing.T) {
+
+    united, alaska := GetBrowserTestOptions()[0], GetBrowserTestOptions()[1]
+    for _,filter := range []struct {
+        airline string
+        united, alaska bool
+    }{
+        { "", true, true },
+        { "UA", true, false },
+        { "UAL", true, false },
+        { "OO", true, false },
+        { "UNITED AIRLINES, INC.", true, false },
+        { "STAR ALLIANCE", true, false },
+        { "ONEWORLD", false, true },
+        { "B6", true, true },
+        { "DL", false, false },
+    } {
+        b := &Browser{ Airline: filter.airline, MaxStops: -1 }
+        if b.Matches(united) != filter.united || b.Matches(alaska) != filter.alaska {
+            t.Errorf("%q: got United %v and Alaska %v, want %v and %v", filter.airline,
+                b.Matches(united), b.Matches(alaska), filter.united, filter.alaska)
+        }
+    }
+
+}
+
+func TestBrowserUpdate(t *testing.T) {
+
+    b := NewBrowser(SearchSummary{}, GetBrowserTestOptions())
+    if len(b.View) != 2 || b.View[0].Price != 200 {
+        t.Fatalf("got %d options with %v first, want both sorted by price",
+            len(b.View), b.View[0].Price)
+    }
+
+    b.Cursor, b.Expanded = 1, true
+    b.Airport = "DEN"
+    b.Update()
+    if len(b.View) != 1 || b.View[0].Price != 300 {
+        t.Errorf("got %d options for DEN, want only the United one", len(b.View))
+    }
+    if b.Cursor != 0 || b.Expanded {
+        t.Errorf("cursor %d and expanded %v weren't reset", b.Cursor, b.Expanded)
+    }
+
+    b.Airport, b.MaxStops = "", 0
+    b.Update()
+    if len(b.View) != 2 {
+        t.Errorf("got %d nonstop options, want 2", len(b.View))
+    }
+
+}
+
+func TestBrowserMove(t *testing.T) {
+
+    var options FlightsResultOptionList
+    for i := 0; i < 20; i++ {
+        option := GetBrowserTestOptions()[0]
+        option.Price = float64(100 + i)
+        options = append(options, option)
+    }
+    b := NewBrowser(SearchSummary{}, options)
+    b.Rows = 14 // Five options to a page
+
+    b.Move(-1)
+    if b.Cursor != 0 || b.Offset != 0 {
+        t.Errorf("moved above the top to %d, offset %d", b.Cursor, b.Offset)
+    }
+    b.Move(6)
+    if b.Cursor != 6 || b.Offset != 2 {
+        t.Errorf("got cursor %d and offset %d, want 6 and 2", b.Cursor, b.Offset)
+    }
+    b.Move(-b.GetPageSize())
+    if b.Cursor != 1 || b.Offset != 1 {
+        t.Errorf("got cursor %d and offset %d after paging up, want 1 and 1",
+            b.Cursor, b.Offset)
+    }
+    b.Move(100)
+    if b.Cursor != 19 || b.Offset != 15 {
+        t.Errorf("moved past the end to %d, offset %d", b.Cursor, b.Offset)
+    }
+
+}
+
+func TestTruncateLine(t *testing.T) {
+    for _,test := range []struct {
+        line string
+        width int
+        want string
+    }{
+        { "SFO -> BOS", 20, "SFO -> BOS" },
+        { "SFO -> BOS", 6, "SFO ->" },
+        { "GRU -> São Paulo", 12, "GRU -> São P" },
+        { "NRT -> 東京", 9, "NRT -> 東京" },
+        { "NRT -> 東京", 8, "NRT -> 東" },
+        { "SFO", 0, "" },
+    } {
+        if got := TruncateLine(test.line, test.width); got != test.want {
+            t.Errorf("%q to %d: got %q, want %q", test.line, test.width, got, test.want)
+        }
+    }
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "os"
+    "strings"
+    "time"
+)
+
+// How holidays in the calendar file affect the generated date pairs
+const (
+    HOLIDAYS_TAG     = "tag"     // Keep every date pair, mark the ones near a holiday
+    HOLIDAYS_EXCLUDE = "exclude" // Drop date pairs that travel near a holiday
+    HOLIDAYS_PREFER  = "prefer"  // Only keep date pairs near a holiday, if any exist
+)
+
+type Calendar struct {
+    Events []CalendarEvent
+}
+
+type CalendarEvent struct {
+    Summary  string
+    Start    time.Time
+    End      time.Time // Exclusive, as in iCal all-day events
+    Blackout bool
+}
+
+/**
+ * Read a calendar from an iCal file. Events whose CATEGORIES include
+ *     BLACKOUT are company blackout days; everything else is a holiday.
+ *
+ * Only the date portion of DTSTART/DTEND is used.
+ */
+func LoadCalendar(path string) (cal *Calendar, err error) {
+
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+
+    // iCal folds long lines by starting the continuation with whitespace
+    var lines []string
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        line := strings.TrimRight(scanner.Text(), "\r")
+        if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+            lines[len(lines)-1] += line[1:]
+        } else {
+            lines = append(lines, line)
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, err
+    }
+
+    cal = new(Calendar)
+    var event *CalendarEvent
+    for _,line := range lines {
+        sep := strings.Index(line, ":")
+        if sep < 0 {
+            continue
+        }
+        // Property parameters (e.g. ;VALUE=DATE) come before the colon
+        name := strings.ToUpper(strings.SplitN(line[:sep], ";", 2)[0])
+        value := line[sep+1:]
+
+        switch {
+        case name == "BEGIN" && value == "VEVENT":
+            event = new(CalendarEvent)
+        case event == nil:
+            continue
+        case name == "END" && value == "VEVENT":
+            if event.End.IsZero() {
+                event.End = event.Start.AddDate(0,0,1)
+            }
+            if !event.Start.IsZero() {
+                cal.Events = append(cal.Events, *event)
+            }
+            event = nil
+        case name == "SUMMARY":
+            event.Summary = value
+        case name == "DTSTART":
+            if event.Start, err = ICalDateToTime(value); err != nil {
+                return nil, fmt.Errorf("DTSTART: %s", err)
+            }
+        case name == "DTEND":
+            if event.End, err = ICalDateToTime(value); err != nil {
+                return nil, fmt.Errorf("DTEND: %s", err)
+            }
+            // Timed events ending partway through a day count that day too
+            if len(value) > 8 && !IsICalMidnight(value) {
+                event.End = event.End.AddDate(0,0,1)
+            }
+        case name == "CATEGORIES":
+            event.Blackout = strings.Contains(strings.ToUpper(value), "BLACKOUT")
+        }
+    }
+
+    return cal, nil
+
+}
+
+// Expected Input Format: 20171123 or 20171123T090000Z
+func ICalDateToTime(dateStr string) (time.Time, error) {
+    const ICAL_DATE_FMT = "20060102"
+    if len(dateStr) < 8 {
+        return time.Time{}, fmt.Errorf("could not interpret calendar date: %q", dateStr)
+    }
+    d, err := time.Parse(ICAL_DATE_FMT, dateStr[:8])
+    if err != nil {
+        return time.Time{}, fmt.Errorf("could not interpret calendar date: %q", dateStr)
+    }
+    return d, nil
+}
+
+// Whether a timed iCal value like 20171124T000000Z is exactly midnight
+func IsICalMidnight(dateStr string) bool {
+    return strings.HasPrefix(dateStr[8:], "T000000")
+}
+
+/**
+ * Names of the holidays that fall within bufferDays of the given date. A nil
+ *     calendar has no holidays.
+ */
+func (cal *Calendar) GetHolidayTags(d time.Time, bufferDays int) (tags []string) {
+    if cal == nil {
+        return nil
+    }
+    lower := d.AddDate(0,0,-bufferDays)
+    upper := d.AddDate(0,0,bufferDays+1)
+    for _,event := range cal.Events {
+        if !event.Blackout && event.Start.Before(upper) && event.End.After(lower) {
+            tags = append(tags, event.Summary)
+        }
+    }
+    return
+}
+
+/**
+ * Whether any day between leaving and returning is a blackout day.
+ */
+func (cal *Calendar) OverlapsBlackout(outbound, inbound time.Time) (bool) {
+    if cal == nil {
+        return false
+    }
+    tripEnd := inbound.AddDate(0,0,1)
+    for _,event := range cal.Events {
+        if event.Blackout && event.Start.Before(tripEnd) && event.End.After(outbound) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+    "time"
+)
+
+// Two holidays, one ending at a timed midnight, and a blackout across two days
+const CALENDAR_FILE = "testdata/calendar.ics"
+
+func TestLoadCalendar(t *testing.T) {
+
+    cal, err := LoadCalendar(CALENDAR_FILE)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []CalendarEvent{
+        { Summary: "Thanksgiving", Start: CalendarTestDate(23), End: CalendarTestDate(24) },
+        { Summary: "Day After Thanksgiving", Start: CalendarTestDate(24),
+            End: CalendarTestDate(25) },
+        { Summary: "Quarter Close", Start: CalendarTestDate(28), End: CalendarTestDate(30),
+            Blackout: true },
+    }
+    if !reflect.DeepEqual(cal.Events, want) {
+        t.Errorf("got events %+v, want %+v", cal.Events, want)
+    }
+
+}
+
+func TestLoadCalendarErrors(t *testing.T) {
+    for _,path := range []string{ "testdata/calendar_bad.ics", "testdata/missing.ics" } {
+        if _, err := LoadCalendar(path); err == nil {
+            t.Errorf("%s loaded without an error", path)
+        }
+    }
+}
+
+func TestCalendarHolidaysAndBlackouts(t *testing.T) {
+
+    cal, err := LoadCalendar(CALENDAR_FILE)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for day,want := range map[int][]string{
+        22: nil,
+        23: { "Thanksgiving" },
+        24: { "Day After Thanksgiving" },
+        25: nil,
+    } {
+        if tags := cal.GetHolidayTags(CalendarTestDate(day), 0); !reflect.DeepEqual(tags, want) {
+            t.Errorf("Nov %d: got tags %q, want %q", day, tags, want)
+        }
+    }
+    if tags := cal.GetHolidayTags(CalendarTestDate(25), 1); len(tags) != 1 {
+        t.Errorf("Nov 25 with a day's buffer: got tags %q", tags)
+    }
+
+    for _,trip := range []struct {
+        outbound, inbound int
+        want bool
+    }{
+        { 22, 27, false },
+        { 22, 28, true },
+        { 29, 30, true },
+        { 30, 30, false },
+    } {
+        if got := cal.OverlapsBlackout(CalendarTestDate(trip.outbound),
+            CalendarTestDate(trip.inbound)); got != trip.want {
+            t.Errorf("Nov %d-%d: got blackout %v", trip.outbound, trip.inbound, got)
+        }
+    }
+
+}
+
+func TestApplyCalendar(t *testing.T) {
+
+    input := InputParams{
+        OriginAirport: "SFO",
+        DestAirport: "BOS",
+        Outbound: DirectionParams{ Dates: []string{ "2017-11-22", "2017-11-26" } },
+        Inbound: DirectionParams{ Dates: []string{ "2017-11-27", "2017-11-28" } },
+        NumPassengers: 1,
+        CalendarFile: CALENDAR_FILE,
+        HolidayBufferDays: 1,
+    }
+    cal, err := input.LoadCalendar()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    for mode,want := range map[string][][2]int{
+        HOLIDAYS_TAG: {{ 22, 27 }, { 26, 27 }},
+        HOLIDAYS_EXCLUDE: {{ 26, 27 }},
+        HOLIDAYS_PREFER: {{ 22, 27 }},
+    } {
+        input.HolidayMode = mode
+        var got [][2]int
+        for _,dateRange := range input.GetValidDateRanges(cal) {
+            got = append(got, [2]int{ dateRange[0].Day(), dateRange[1].Day() })
+        }
+        if !reflect.DeepEqual(got, want) {
+            t.Errorf("%s: got date pairs %v, want %v", mode, got, want)
+        }
+    }
+
+    input.HolidayMode = "avoid"
+    if err := input.Validate(); err == nil {
+        t.Error("unknown holiday mode was accepted")
+    }
+
+}
+
+func CalendarTestDate(day int) time.Time {
+    return time.Date(2017, time.November, day, 0, 0, 0, 0, time.UTC)
+}
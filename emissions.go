@@ -0,0 +1,142 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "github.com/StephensAndrewM/FlightFinder/refdata"
+)
+
+/**
+ * kg of CO2 per passenger mile flown in economy, by the length of the leg.
+ *     Short legs burn proportionally more taking off and climbing. Loosely
+ *     based on the UK government conversion factors, without the uplift for
+ *     non-CO2 effects.
+ */
+var CO2_PER_MILE_BANDS = []struct{ MaxMiles, KgPerMile float64 }{
+    { 500,  0.40 },
+    { 2300, 0.25 },
+    { math.Inf(1), 0.24 },
+}
+
+// Bigger seats take a bigger share of the aircraft, by QPX cabin name
+var CABIN_CO2_MULTIPLIERS = map[string]float64{
+    "COACH":         1.0,
+    "PREMIUM_COACH": 1.6,
+    "BUSINESS":      2.9,
+    "FIRST":         4.0,
+}
+
+func EstimateLegCO2(miles float64, cabin string) float64 {
+    multiplier, ok := CABIN_CO2_MULTIPLIERS[cabin]
+    if !ok {
+        multiplier = 1.0
+    }
+    for _,band := range CO2_PER_MILE_BANDS {
+        if miles <= band.MaxMiles {
+            return miles * band.KgPerMile * multiplier
+        }
+    }
+    return 0
+}
+
+/**
+ * Fill in the distance and emissions of a slice and its segments. Each leg
+ *     is measured separately, so a flight that stops on the way counts the
+ *     extra distance. Everything stays zero if any airport's location isn't
+ *     in the reference data.
+ */
+func (slice *FlightsResultSlice) ApplyDistances() {
+
+    slice.Distance, slice.DirectDistance, slice.DetourRatio, slice.CO2 = 0, 0, 0, 0
+    if len(slice.Segments) == 0 {
+        return
+    }
+    for i := range slice.Segments {
+        segment := &slice.Segments[i]
+        if !segment.ApplyDistance() {
+            for j := range slice.Segments {
+                slice.Segments[j].Distance, slice.Segments[j].CO2 = 0, 0
+            }
+            return
+        }
+        slice.Distance += segment.Distance
+        slice.CO2 += segment.CO2
+    }
+
+    first := slice.Segments[0]
+    last := slice.Segments[len(slice.Segments)-1]
+    slice.DirectDistance, _ = refdata.DistanceBetween(first.Origin, last.Destination)
+    if slice.DirectDistance > 0 {
+        slice.DetourRatio = slice.Distance / slice.DirectDistance
+    }
+
+}
+
+// Not ok if an airport isn't known. Runs saved before legs were kept are
+//     measured from origin to destination.
+func (segment *FlightsResultSegment) ApplyDistance() (ok bool) {
+
+    segment.Distance, segment.CO2 = 0, 0
+    hops := [][2]string{}
+    for _,leg := range segment.Legs {
+        hops = append(hops, [2]string{ leg.Origin, leg.Destination })
+    }
+    if len(hops) == 0 {
+        hops = append(hops, [2]string{ segment.Origin, segment.Destination })
+    }
+    for _,hop := range hops {
+        miles, known := refdata.DistanceBetween(hop[0], hop[1])
+        if !known {
+            return false
+        }
+        segment.Distance += miles
+        segment.CO2 += EstimateLegCO2(miles, segment.Cabin)
+    }
+    return true
+
+}
+
+// Zero if either slice couldn't be measured
+func (option FlightsResultOption) GetCO2() (co2 float64) {
+    for _,slice := range option.Slices {
+        if slice.CO2 == 0 {
+            return 0
+        }
+        co2 += slice.CO2
+    }
+    return
+}
+
+// The worse of the two slices. Zero if either couldn't be measured.
+func (option FlightsResultOption) GetDetourRatio() (ratio float64) {
+    for _,slice := range option.Slices {
+        if slice.DetourRatio == 0 {
+            return 0
+        }
+        ratio = math.Max(ratio, slice.DetourRatio)
+    }
+    return
+}
+
+// e.g. "2697 mi (1.00x direct), 675 kg CO2"
+func DescribeSliceDistance(slice FlightsResultSlice) string {
+    if slice.Distance == 0 {
+        return "Unknown"
+    }
+    return fmt.Sprintf("%.0f mi (%.2fx direct), %.0f kg CO2",
+        slice.Distance, slice.DetourRatio, slice.CO2)
+}
+
+// e.g. "5395 mi, 1.05x direct, 1349 kg CO2 per passenger"
+func DescribeEmissions(option FlightsResultOption) string {
+    co2 := option.GetCO2()
+    if co2 == 0 {
+        return "Distance unknown"
+    }
+    var distance float64
+    for _,slice := range option.Slices {
+        distance += slice.Distance
+    }
+    return fmt.Sprintf("%.0f mi, %.2fx direct, %.0f kg CO2 per passenger",
+        distance, option.GetDetourRatio(), co2)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "io"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Machine-readable versions of the result types. Field names here are part
+//     of the output format, so rename with care.
+type ExportResults struct {
+    AttemptedRequests int     `json:"attempted_requests"`
+    SuccessfulRequests int    `json:"successful_requests"`
+    Warnings []string         `json:"warnings"`
+    Options []ExportOption    `json:"options"`
+}
+
+type ExportOption struct {
+    Rank int                  `json:"rank"`
+    Price float64             `json:"price"`
+    BagFees float64           `json:"bag_fees"`
+    EffectivePrice float64    `json:"effective_price"`
+    CO2Kg float64             `json:"co2_kg"`
+    Fare *ExportFare          `json:"fare,omitempty"`
+    Slices []ExportSlice      `json:"slices"`
+}
+
+// Left out for options saved without pricing detail
+type ExportFare struct {
+    BaseFare float64          `json:"base_fare"`
+    Taxes float64             `json:"taxes"`
+    TaxBreakdown map[string]float64 `json:"tax_breakdown"`
+    FareCalculation string    `json:"fare_calculation"`
+    FareBasis []string        `json:"fare_basis"`
+    Refundable bool           `json:"refundable"`
+    FreeBags int              `json:"free_bags"`
+}
+
+type ExportSlice struct {
+    Direction string          `json:"direction"`
+    DurationMinutes int       `json:"duration_minutes"`
+    DistanceMiles float64     `json:"distance_miles"`
+    DirectDistanceMiles float64 `json:"direct_distance_miles"`
+    DetourRatio float64       `json:"detour_ratio"`
+    CO2Kg float64             `json:"co2_kg"`
+    DateTags []string         `json:"date_tags"`
+    Segments []ExportSegment  `json:"segments"`
+}
+
+type ExportSegment struct {
+    Airline string            `json:"airline"`
+    MarketingCarrier string   `json:"marketing_carrier"`
+    OperatingCarrier string   `json:"operating_carrier"`
+    OperatingCarrierCode string `json:"operating_carrier_code"`
+    FlightNumber string       `json:"flight_number"`
+    Origin string             `json:"origin"`
+    Destination string        `json:"destination"`
+    DepartureTime string      `json:"departure_time"`
+    ArrivalTime string        `json:"arrival_time"`
+    NumLegs int               `json:"num_legs"`
+    BookingCode string        `json:"booking_code"`
+    Cabin string              `json:"cabin"`
+    DistanceMiles float64     `json:"distance_miles"`
+    CO2Kg float64             `json:"co2_kg"`
+    Legs []ExportLeg          `json:"legs"`
+}
+
+type ExportLeg struct {
+    Origin string                `json:"origin"`
+    Destination string           `json:"destination"`
+    OriginTerminal string        `json:"origin_terminal"`
+    DestinationTerminal string   `json:"destination_terminal"`
+    DepartureTime string         `json:"departure_time"`
+    ArrivalTime string           `json:"arrival_time"`
+    DurationMinutes int          `json:"duration_minutes"`
+    Aircraft string              `json:"aircraft"`
+    OnTimePerformance int        `json:"on_time_performance"`
+    Meal string                  `json:"meal"`
+    OperatingCarrier string      `json:"operating_carrier"`
+    Mileage int                  `json:"mileage"`
+}
+
+var SLICE_DIRECTIONS = [2]string{ "outbound", "inbound" }
+
+func NewExportResults(summary SearchSummary, optionsList FlightsResultOptionList) (
+    results ExportResults) {
+
+    results.AttemptedRequests = summary.AttemptedRequests
+    results.SuccessfulRequests = summary.Successes
+    results.Warnings = summary.Warnings
+    if results.Warnings == nil {
+        results.Warnings = []string{}
+    }
+    results.Options = []ExportOption{}
+    for i,option := range optionsList {
+        results.Options = append(results.Options, NewExportOption(i+1, option))
+    }
+    return
+
+}
+
+func NewExportOption(rank int, option FlightsResultOption) (export ExportOption) {
+
+    export.Rank = rank
+    export.Price = option.Price
+    export.BagFees = option.BagFees
+    export.EffectivePrice = option.GetEffectivePrice()
+    export.CO2Kg = option.GetCO2()
+    if option.Fare.HasPricing {
+        export.Fare = &ExportFare{
+            BaseFare: option.Fare.BaseFare,
+            Taxes: option.Fare.Taxes,
+            TaxBreakdown: make(map[string]float64),
+            FareCalculation: option.Fare.FareCalculation,
+            FareBasis: option.Fare.FareBasis,
+            Refundable: option.Fare.Refundable,
+            FreeBags: option.Fare.FreeBags,
+        }
+        for _,tax := range option.Fare.TaxBreakdown {
+            export.Fare.TaxBreakdown[tax.Code] = tax.Amount
+        }
+        if export.Fare.FareBasis == nil {
+            export.Fare.FareBasis = []string{}
+        }
+    }
+    for i,slice := range option.Slices {
+        exportSlice := ExportSlice{
+            Direction: SLICE_DIRECTIONS[i],
+            DurationMinutes: int(slice.Duration / time.Minute),
+            DistanceMiles: slice.Distance,
+            DirectDistanceMiles: slice.DirectDistance,
+            DetourRatio: slice.DetourRatio,
+            CO2Kg: slice.CO2,
+            DateTags: slice.DateTags,
+            Segments: []ExportSegment{},
+        }
+        if exportSlice.DateTags == nil {
+            exportSlice.DateTags = []string{}
+        }
+        for _,segment := range slice.Segments {
+            exportSegment := ExportSegment{
+                Airline: segment.Airline,
+                MarketingCarrier: segment.GetCarrierCode(),
+                OperatingCarrier: segment.OperatingCarrier,
+                OperatingCarrierCode: segment.OperatingCarrierCode,
+                FlightNumber: segment.FlightNumber,
+                Origin: segment.Origin,
+                Destination: segment.Destination,
+                DepartureTime: segment.DepartureTime.Format(time.RFC3339),
+                ArrivalTime: segment.ArrivalTime.Format(time.RFC3339),
+                NumLegs: segment.NumLegs,
+                BookingCode: segment.BookingCode,
+                Cabin: segment.Cabin,
+                DistanceMiles: segment.Distance,
+                CO2Kg: segment.CO2,
+                Legs: []ExportLeg{},
+            }
+            for _,leg := range segment.Legs {
+                exportSegment.Legs = append(exportSegment.Legs, ExportLeg{
+                    Origin: leg.Origin,
+                    Destination: leg.Destination,
+                    OriginTerminal: leg.OriginTerminal,
+                    DestinationTerminal: leg.DestinationTerminal,
+                    DepartureTime: leg.DepartureTime.Format(time.RFC3339),
+                    ArrivalTime: leg.ArrivalTime.Format(time.RFC3339),
+                    DurationMinutes: int(leg.Duration / time.Minute),
+                    Aircraft: leg.Aircraft,
+                    OnTimePerformance: leg.OnTimePerformance,
+                    Meal: leg.Meal,
+                    OperatingCarrier: leg.OperatingCarrier,
+                    Mileage: leg.Mileage,
+                })
+            }
+            exportSlice.Segments = append(exportSlice.Segments, exportSegment)
+        }
+        export.Slices = append(export.Slices, exportSlice)
+    }
+    return
+
+}
+
+/**
+ * The whole ranked option list, with the request summary, as one document.
+ */
+type JSONRenderer struct {}
+
+func (r JSONRenderer) Render(w io.Writer, summary SearchSummary,
+    optionsList FlightsResultOptionList) error {
+
+    results := NewExportResults(summary, optionsList)
+    encoder := json.NewEncoder(w)
+    encoder.SetIndent("", "  ")
+    return encoder.Encode(results)
+
+}
+
+/**
+ * One ranked option per line, for streaming into line-based tools.
+ */
+type NDJSONRenderer struct {}
+
+func (r NDJSONRenderer) Render(w io.Writer, summary SearchSummary,
+    optionsList FlightsResultOptionList) error {
+
+    encoder := json.NewEncoder(w)
+    for i,option := range optionsList {
+        if err := encoder.Encode(NewExportOption(i+1, option)); err != nil {
+            return err
+        }
+    }
+    return nil
+
+}
+
+/**
+ * One row per option, with each slice flattened into its own set of columns.
+ *     Multi-segment values are joined with semicolons.
+ */
+type CSVRenderer struct {}
+
+func (r CSVRenderer) Render(w io.Writer, summary SearchSummary,
+    optionsList FlightsResultOptionList) error {
+
+    header := []string{ "rank", "price" }
+    for _,direction := range SLICE_DIRECTIONS {
+        for _,column := range []string{ "origin", "destination",
+            "departure_time", "arrival_time", "duration_minutes", "stops",
+            "flight_numbers", "airlines", "date_tags" } {
+            header = append(header, direction + "_" + column)
+        }
+    }
+    header = append(header, "base_fare", "taxes", "fare_basis", "booking_codes",
+        "refundable", "free_bags", "bag_fees", "effective_price")
+    for _,direction := range SLICE_DIRECTIONS {
+        header = append(header, direction + "_distance_miles", direction + "_detour_ratio")
+    }
+    header = append(header, "co2_kg")
+
+    writer := csv.NewWriter(w)
+    writer.Write(header)
+
+    for i,option := range optionsList {
+        export := NewExportOption(i+1, option)
+        row := []string{
+            strconv.Itoa(export.Rank),
+            strconv.FormatFloat(export.Price, 'f', 2, 64),
+        }
+        for _,slice := range export.Slices {
+            // Saved options can have an empty slice; keep the columns lined up
+            if len(slice.Segments) == 0 {
+                row = append(row, "", "", "", "", "", "", "", "",
+                    strings.Join(slice.DateTags, ";"))
+                continue
+            }
+            var flightNumbers, airlines []string
+            stops := -1
+            for _,segment := range slice.Segments {
+                flightNumbers = append(flightNumbers, segment.FlightNumber)
+                airlines = append(airlines, segment.Airline)
+                stops += segment.NumLegs
+            }
+            first := slice.Segments[0]
+            last := slice.Segments[len(slice.Segments)-1]
+            row = append(row,
+                first.Origin,
+                last.Destination,
+                first.DepartureTime,
+                last.ArrivalTime,
+                strconv.Itoa(slice.DurationMinutes),
+                strconv.Itoa(stops),
+                strings.Join(flightNumbers, ";"),
+                strings.Join(airlines, ";"),
+                strings.Join(slice.DateTags, ";"))
+        }
+
+        // Fare columns stay empty for options saved without pricing detail
+        if fare := export.Fare; fare != nil {
+            row = append(row,
+                strconv.FormatFloat(fare.BaseFare, 'f', 2, 64),
+                strconv.FormatFloat(fare.Taxes, 'f', 2, 64),
+                strings.Join(fare.FareBasis, ";"),
+                strings.Join(option.GetBookingCodes(), ";"),
+                strconv.FormatBool(fare.Refundable),
+                strconv.Itoa(fare.FreeBags))
+        } else {
+            row = append(row, "", "", "", "", "", "")
+        }
+        row = append(row,
+            strconv.FormatFloat(export.BagFees, 'f', 2, 64),
+            strconv.FormatFloat(export.EffectivePrice, 'f', 2, 64))
+
+        // Distance columns stay empty when an airport's location isn't known
+        for _,slice := range export.Slices {
+            if slice.DistanceMiles > 0 {
+                row = append(row,
+                    strconv.FormatFloat(slice.DistanceMiles, 'f', 0, 64),
+                    strconv.FormatFloat(slice.DetourRatio, 'f', 2, 64))
+            } else {
+                row = append(row, "", "")
+            }
+        }
+        if export.CO2Kg > 0 {
+            row = append(row, strconv.FormatFloat(export.CO2Kg, 'f', 0, 64))
+        } else {
+            row = append(row, "")
+        }
+        writer.Write(row)
+    }
+
+    writer.Flush()
+    return writer.Error()
+
+}
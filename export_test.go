@@ -0,0 +1,104 @@
+package main
+
+import (
+    "bytes"
+    "encoding/csv"
+    "encoding/json"
+    "testing"
+)
+
+func GetExportTestOptions() FlightsResultOptionList {
+    options := GetBrowserTestOptions()
+    options[0].BagFees = 60
+    options[0].EffectivePrice = 360
+    options[0].Fare = FlightsResultFare{
+        HasPricing: true,
+        BaseFare: 246.50,
+        Taxes: 53.50,
+        TaxBreakdown: []FlightsResultTax{{ Code: "US", Amount: 18.50 }},
+        FareBasis: []string{ "KA7NA0MN" },
+    }
+    options[0].Slices[0].DateTags = []string{ "Thanksgiving" }
+    // As saved by a run from before malformed options were skipped
+    options[1].Slices[1].Segments = nil
+    return options
+}
+
+func TestCSVRenderer(t *testing.T) {
+
+    buf := new(bytes.Buffer)
+    if err := (CSVRenderer{}).Render(buf, SearchSummary{}, GetExportTestOptions()); err != nil {
+        t.Fatal(err)
+    }
+    rows, err := csv.NewReader(buf).ReadAll()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(rows) != 3 {
+        t.Fatalf("got %d rows, want a header and 2 options", len(rows))
+    }
+
+    columns := make(map[string]int)
+    for i,name := range rows[0] {
+        columns[name] = i
+    }
+    for column,want := range map[string][2]string{
+        "rank": { "1", "2" },
+        "price": { "300.00", "200.00" },
+        "outbound_origin": { "SFO", "OAK" },
+        "outbound_stops": { "0", "0" },
+        "outbound_date_tags": { "Thanksgiving", "" },
+        "inbound_flight_numbers": { "B6 434", "" },
+        "inbound_destination": { "SFO", "" },
+        "base_fare": { "246.50", "" },
+        "fare_basis": { "KA7NA0MN", "" },
+        "effective_price": { "360.00", "200.00" },
+    } {
+        i, ok := columns[column]
+        if !ok {
+            t.Errorf("no %s column", column)
+            continue
+        }
+        if rows[1][i] != want[0] || rows[2][i] != want[1] {
+            t.Errorf("%s: got %q and %q, want %q and %q", column, rows[1][i], rows[2][i],
+                want[0], want[1])
+        }
+    }
+
+}
+
+func TestJSONRenderer(t *testing.T) {
+
+    buf := new(bytes.Buffer)
+    summary := SearchSummary{ AttemptedRequests: 3, Successes: 2, Warnings: []string{ "w" } }
+    if err := (JSONRenderer{}).Render(buf, summary, GetExportTestOptions()); err != nil {
+        t.Fatal(err)
+    }
+    var results ExportResults
+    if err := json.Unmarshal(buf.Bytes(), &results); err != nil {
+        t.Fatal(err)
+    }
+
+    if results.AttemptedRequests != 3 || results.SuccessfulRequests != 2 ||
+        len(results.Warnings) != 1 || len(results.Options) != 2 {
+        t.Fatalf("unexpected summary: %+v", results)
+    }
+    first, second := results.Options[0], results.Options[1]
+    if first.Rank != 1 || first.EffectivePrice != 360 || first.BagFees != 60 {
+        t.Errorf("unexpected prices: %+v", first)
+    }
+    if first.Fare == nil || first.Fare.TaxBreakdown["US"] != 18.50 {
+        t.Errorf("unexpected fare: %+v", first.Fare)
+    }
+    if second.Fare != nil {
+        t.Errorf("option without pricing has fare %+v", second.Fare)
+    }
+    if len(first.Slices) != 2 || first.Slices[0].Segments[0].FlightNumber != "UA 100" ||
+        first.Slices[0].Segments[0].NumLegs != 1 || first.Slices[0].Direction != "outbound" {
+        t.Errorf("unexpected slices: %+v", first.Slices)
+    }
+    if len(second.Slices) != 2 || len(second.Slices[1].Segments) != 0 {
+        t.Errorf("empty slice wasn't kept: %+v", second.Slices)
+    }
+
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+    "github.com/mitchellh/hashstructure"
+)
+
+const FARES_SCHEMA = `
+CREATE TABLE IF NOT EXISTS fares (
+    run_id INTEGER NOT NULL REFERENCES runs(id),
+    search_key TEXT NOT NULL,
+    itinerary TEXT NOT NULL,
+    price REAL NOT NULL,
+    recorded_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS fares_search ON fares(search_key, itinerary);
+`
+
+// Fares within this fraction of each other count as unchanged
+const FARE_TREND_THRESHOLD = 0.01
+
+const (
+    TREND_UP   = "rising"
+    TREND_DOWN = "falling"
+    TREND_FLAT = "flat"
+)
+
+type FarePoint struct {
+    RunID int64
+    RecordedAt time.Time
+    Price float64
+}
+
+type ItineraryFareHistory struct {
+    Itinerary string
+    Points []FarePoint
+}
+
+// The dates a direction may be flown on, however the input gives them
+type SearchKeyDates struct {
+    Date string
+    Dates []string
+    DateRange [2]string
+    WeekdayExclusions string
+}
+
+// The ranking options that drop fares, rather than just reordering them
+type SearchKeyFilters struct {
+    RequireRefundable bool
+    MinFreeBags int
+    BlockedAirlines []string
+    ByOperatingCarrier bool
+    MaxDetourRatio float64
+}
+
+/**
+ * Identifies the same search across runs. Only the route, dates, travellers
+ *     and trip length count, so new input options don't start a new fare
+ *     history. Bags count since the recorded prices include their fees, and
+ *     so do the ranking filters since fares they drop aren't recorded.
+ */
+func (input InputParams) GetSearchKey() (string) {
+    // Any airports are allowed when none is given
+    returnAirports := input.ReturnAirports
+    if returnAirports == "" {
+        returnAirports = RETURN_ANY
+    }
+    search := struct {
+        OriginAirports []string
+        DestAirports []string
+        ReturnAirports string
+        Outbound SearchKeyDates
+        Inbound SearchKeyDates
+        NumPassengers int
+        CheckedBags int
+        CarryOnBags int
+        MinTripLength int
+        MaxTripLength int
+        Filters SearchKeyFilters
+    }{
+        OriginAirports: input.GetOriginAirports(),
+        DestAirports: input.GetDestAirports(),
+        ReturnAirports: returnAirports,
+        Outbound: input.Outbound.GetSearchKeyDates(),
+        Inbound: input.Inbound.GetSearchKeyDates(),
+        NumPassengers: input.NumPassengers,
+        CheckedBags: input.CheckedBags,
+        CarryOnBags: input.CarryOnBags,
+        MinTripLength: input.MinTripLength,
+        MaxTripLength: input.MaxTripLength,
+        Filters: input.Ranking.GetSearchKeyFilters(),
+    }
+    hash, err := hashstructure.Hash(search, nil)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error creating hash for search: %s\n", err)
+    }
+    return strconv.FormatUint(hash, 10)
+}
+
+func (direction DirectionParams) GetSearchKeyDates() SearchKeyDates {
+    return SearchKeyDates{
+        Date: direction.Date,
+        Dates: direction.Dates,
+        DateRange: direction.DateRange,
+        WeekdayExclusions: direction.WeekdayExclusions,
+    }
+}
+
+func (ranking RankingParams) GetSearchKeyFilters() SearchKeyFilters {
+    return SearchKeyFilters{
+        RequireRefundable: ranking.RequireRefundable,
+        MinFreeBags: ranking.MinFreeBags,
+        BlockedAirlines: ranking.BlockedAirlines,
+        ByOperatingCarrier: ranking.ByOperatingCarrier,
+        MaxDetourRatio: ranking.MaxDetourRatio,
+    }
+}
+
+/**
+ * Identifies the same itinerary across runs, by date and flight numbers.
+ *
+ * Expected Output Format: 2017-03-29 UA 123/UA 456 | 2017-04-02 UA 789
+ */
+func (o FlightsResultOption) GetItineraryKey() (string) {
+    const DATE_FMT = "2006-01-02"
+    var slices []string
+    for _,slice := range o.Slices {
+        if len(slice.Segments) == 0 {
+            continue
+        }
+        var flightNumbers []string
+        for _,segment := range slice.Segments {
+            flightNumbers = append(flightNumbers, segment.FlightNumber)
+        }
+        slices = append(slices, slice.Segments[0].DepartureTime.Format(DATE_FMT) +
+            " " + strings.Join(flightNumbers, "/"))
+    }
+    return strings.Join(slices, " | ")
+}
+
+/**
+ * Record the cheapest price seen for each itinerary in a run, bag fees
+ *     included. Itineraries the ranking doesn't allow are left out, so the
+ *     best recorded price is one a watch could alert on.
+ */
+func (h *History) RecordFares(runID int64, input InputParams,
+    resList []FlightsResult, recordedAt time.Time) (err error) {
+
+    if _, err = h.db.Exec(FARES_SCHEMA); err != nil {
+        return
+    }
+
+    best := make(map[string]float64)
+    options, _ := FlattenResponses(resList, input.Ranking)
+    for _,option := range options {
+        key := option.GetItineraryKey()
+        if price, ok := best[key]; !ok || option.GetEffectivePrice() < price {
+            best[key] = option.GetEffectivePrice()
+        }
+    }
+
+    tx, err := h.db.Begin()
+    if err != nil {
+        return
+    }
+    searchKey := input.GetSearchKey()
+    for itinerary, price := range best {
+        _, err = tx.Exec(`INSERT INTO fares
+            (run_id, search_key, itinerary, price, recorded_at)
+            VALUES (?, ?, ?, ?, ?)`,
+            runID, searchKey, itinerary, price, recordedAt.Format(time.RFC3339))
+        if err != nil {
+            tx.Rollback()
+            return
+        }
+    }
+    return tx.Commit()
+
+}
+
+/**
+ * Price history of every itinerary a search has turned up, oldest first.
+ */
+func (h *History) LoadFareHistory(searchKey string) (
+    histories []ItineraryFareHistory, err error) {
+
+    if _, err = h.db.Exec(FARES_SCHEMA); err != nil {
+        return
+    }
+
+    rows, err := h.db.Query(`SELECT itinerary, run_id, recorded_at, price
+        FROM fares WHERE search_key = ? ORDER BY itinerary, run_id`, searchKey)
+    if err != nil {
+        return
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var itinerary, recordedAt string
+        var point FarePoint
+        if err = rows.Scan(&itinerary, &point.RunID, &recordedAt, &point.Price); err != nil {
+            return
+        }
+        if point.RecordedAt, err = time.Parse(time.RFC3339, recordedAt); err != nil {
+            return
+        }
+        if len(histories) == 0 || histories[len(histories)-1].Itinerary != itinerary {
+            histories = append(histories, ItineraryFareHistory{ Itinerary: itinerary })
+        }
+        last := &histories[len(histories)-1]
+        last.Points = append(last.Points, point)
+    }
+    err = rows.Err()
+    return
+
+}
+
+func (history ItineraryFareHistory) GetPrices() (prices []float64) {
+    for _,point := range history.Points {
+        prices = append(prices, point.Price)
+    }
+    return
+}
+
+func (history ItineraryFareHistory) GetLatest() (FarePoint) {
+    return history.Points[len(history.Points)-1]
+}
+
+func (history ItineraryFareHistory) GetMinMaxMedian() (min, max, median float64) {
+    prices := history.GetPrices()
+    sort.Float64s(prices)
+    min = prices[0]
+    max = prices[len(prices)-1]
+    if len(prices) % 2 == 1 {
+        median = prices[len(prices)/2]
+    } else {
+        median = (prices[len(prices)/2-1] + prices[len(prices)/2]) / 2
+    }
+    return
+}
+
+/**
+ * Direction of the latest price compared to the one before it.
+ */
+func (history ItineraryFareHistory) GetTrend() (string) {
+    if len(history.Points) < 2 {
+        return TREND_FLAT
+    }
+    latest := history.Points[len(history.Points)-1].Price
+    previous := history.Points[len(history.Points)-2].Price
+    switch {
+    case latest > previous*(1+FARE_TREND_THRESHOLD):
+        return TREND_UP
+    case latest < previous*(1-FARE_TREND_THRESHOLD):
+        return TREND_DOWN
+    default:
+        return TREND_FLAT
+    }
+}
+
+/**
+ * Show how fares for a saved search have moved. With no run id, the search
+ *     is the one in input.go.
+ */
+func FareHistoryCommand(args []string, config AppConfig) (error) {
+
+    history, err := OpenHistory(config.HistoryFile)
+    if err != nil {
+        return fmt.Errorf("could not open history database: %s", err)
+    }
+    defer history.Close()
+
+    input := Input
+    if len(args) > 0 {
+        runID, err := strconv.ParseInt(args[0], 10, 64)
+        if err != nil {
+            return fmt.Errorf("could not interpret run id: %s", args[0])
+        }
+        run, err := history.LoadRun(runID)
+        if err != nil {
+            return fmt.Errorf("could not load run %d: %s", runID, err)
+        }
+        input = run.Input
+    }
+
+    histories, err := history.LoadFareHistory(input.GetSearchKey())
+    if err != nil {
+        return fmt.Errorf("could not read fare history: %s", err)
+    }
+
+    // Itineraries still on offer in the latest run come first, cheapest first
+    sort.SliceStable(histories, func(i, j int) bool {
+        a, b := histories[i].GetLatest(), histories[j].GetLatest()
+        if a.RunID == b.RunID {
+            return a.Price < b.Price
+        }
+        return a.RunID > b.RunID
+    })
+    histories = histories[:Min(len(histories), GetResultLimit(input.ResultLimit))]
+
+    fmt.Printf("Fare history for %s\n", DescribeRoute(input))
+    PrintFareHistory(os.Stdout, histories)
+    return nil
+
+}
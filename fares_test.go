@@ -0,0 +1,58 @@
+package main
+
+import (
+    "testing"
+)
+
+func TestGetSearchKey(t *testing.T) {
+
+    input := GetReplayInput()
+    key := input.GetSearchKey()
+
+    same := input
+    same.OriginAirports = nil
+    same.OriginAirport = "SFO"
+    same.DestAirport, same.DestAirports = "", []string{ "BOS" }
+    single := input
+    single.OriginAirports = []string{ "SFO" }
+    if same.GetSearchKey() != single.GetSearchKey() {
+        t.Error("one airport given two ways got different keys")
+    }
+
+    unrelated := input
+    unrelated.OutputFormat = OUTPUT_MATRIX
+    unrelated.Ranking = RankingParams{ PreferFlexible: true, PreferredAirlines: []string{ "B6" } }
+    unrelated.CalendarFile = CALENDAR_FILE
+    unrelated.SearchMode = SEARCH_INCREMENTAL
+    unrelated.QueryBudget = 10
+    if unrelated.GetSearchKey() != key {
+        t.Error("options that don't change the route changed the key")
+    }
+
+    anyReturn := input
+    anyReturn.ReturnAirports = RETURN_ANY
+    noReturn := input
+    noReturn.ReturnAirports = ""
+    if anyReturn.GetSearchKey() != noReturn.GetSearchKey() {
+        t.Error("the default return airports got a different key from \"any\"")
+    }
+
+    for name,change := range map[string]func(*InputParams){
+        "airports": func(input *InputParams) { input.DestAirport = "PVD" },
+        "return mode": func(input *InputParams) { input.ReturnAirports = RETURN_ANY },
+        "dates": func(input *InputParams) { input.Inbound.Date = "2017-04-03" },
+        "passengers": func(input *InputParams) { input.NumPassengers = 2 },
+        "trip length": func(input *InputParams) { input.MaxTripLength = 7 },
+        "blocked airlines": func(input *InputParams) {
+            input.Ranking.BlockedAirlines = []string{ "UA" }
+        },
+        "refundability": func(input *InputParams) { input.Ranking.RequireRefundable = true },
+    } {
+        changed := input
+        change(&changed)
+        if changed.GetSearchKey() == key {
+            t.Errorf("changing the %s kept the key", name)
+        }
+    }
+
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "flag"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "testing"
+    "github.com/fatih/color"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current output")
+
+const GOLDEN_DIR = "testdata/golden"
+
+/**
+ * Compare output with the golden file of the same name, or replace the file
+ *     when running with -update. Review the diff before committing.
+ */
+func CheckGolden(t *testing.T, name string, got []byte) {
+
+    t.Helper()
+    path := filepath.Join(GOLDEN_DIR, name)
+    if *update {
+        if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+            t.Fatal(err)
+        }
+        if err := ioutil.WriteFile(path, got, 0644); err != nil {
+            t.Fatal(err)
+        }
+        return
+    }
+
+    want, err := ioutil.ReadFile(path)
+    if err != nil {
+        t.Fatalf("%s (run with -update to create it)", err)
+    }
+    if !bytes.Equal(got, want) {
+        t.Errorf("output differs from %s (run with -update to accept it)\n--- got:\n%s\n--- want:\n%s",
+            path, got, want)
+    }
+
+}
+
+func MarshalGolden(t *testing.T, v interface{}) []byte {
+    t.Helper()
+    data, err := json.MarshalIndent(v, "", "  ")
+    if err != nil {
+        t.Fatal(err)
+    }
+    return append(data, '\n')
+}
+
+// Searches covering each way the input can describe airports and dates
+var GOLDEN_INPUTS = map[string]InputParams{
+    "single_dates": {
+        OriginAirport: "SFO",
+        DestAirport: "BOS",
+        Outbound: DirectionParams{ Date: "2017-03-29" },
+        Inbound: DirectionParams{ Date: "2017-04-02" },
+        NumPassengers: 1,
+    },
+    "date_ranges": {
+        OriginAirport: "BDL",
+        DestAirports: []string{ "SFO", "SJC" },
+        Outbound: DirectionParams{
+            DateRange: [2]string{ "2017-03-29", "2017-03-31" },
+        },
+        Inbound: DirectionParams{
+            DateRange: [2]string{ "2017-04-02", "2017-04-03" },
+        },
+        NumPassengers: 2,
+        MinTripLength: 4,
+    },
+    "return_one_end": {
+        OriginAirports: []string{ "SFO", "SJC" },
+        DestAirports: []string{ "BOS", "PVD" },
+        ReturnAirports: RETURN_ONE_END,
+        Outbound: DirectionParams{ Dates: []string{ "2017-11-21", "2017-11-22" } },
+        Inbound: DirectionParams{ Date: "2017-11-26" },
+        NumPassengers: 1,
+        CheckedBags: 1,
+    },
+    "time_and_legs": {
+        OriginAirport: "SFO",
+        DestAirport: "ORD",
+        Outbound: DirectionParams{
+            Date: "2017-03-29",
+            TimeRange: [2]string{ "06:00", "12:00" },
+            MaxLegs: 1,
+        },
+        Inbound: DirectionParams{
+            DateRange: [2]string{ "2017-04-01", "2017-04-03" },
+            WeekdayExclusions: "S",
+            MaxLegs: 2,
+        },
+        NumPassengers: 1,
+        MaxTripLength: 4,
+    },
+}
+
+func TestGoldenFlightRequests(t *testing.T) {
+    for name,input := range GOLDEN_INPUTS {
+        t.Run(name, func(t *testing.T) {
+            reqList := BuildFlightRequest(input, nil)
+            CheckGolden(t, "requests/" + name + ".json", MarshalGolden(t, reqList))
+
+            var qpxReqList []QPXRequest
+            for _,req := range reqList {
+                qpxReqList = append(qpxReqList, BuildQPXRequest(req))
+            }
+            CheckGolden(t, "qpx_requests/" + name + ".json", MarshalGolden(t, qpxReqList))
+        })
+    }
+}
+
+// Responses arrive in any order, so they're sorted by origin
+func GetGoldenResults(t *testing.T) (resList []FlightsResult) {
+    config := AppConfig{ ReplayDir: REPLAY_DIR }
+    resList, err := SendQPXRequests(BuildFlightRequest(GetReplayInput(), nil), config)
+    if err != nil {
+        t.Fatal(err)
+    }
+    sort.Slice(resList, func(i, j int) bool {
+        return resList[i].Request.Slices[0].Origin < resList[j].Request.Slices[0].Origin
+    })
+    return
+}
+
+func TestGoldenResults(t *testing.T) {
+    for _,res := range GetGoldenResults(t) {
+        name := strings.ToLower(res.Request.Slices[0].Origin)
+        CheckGolden(t, "results/" + name + ".json", MarshalGolden(t, res))
+    }
+}
+
+func TestGoldenOutput(t *testing.T) {
+
+    color.NoColor = true
+    resList := GetGoldenResults(t)
+    options, successes := FlattenResponses(resList, RankingParams{})
+    summary := SearchSummary{ AttemptedRequests: len(resList), Successes: successes,
+        Warnings: CollectWarnings(resList) }
+
+    renderers := map[string]Renderer{
+        "cards.txt": CardRenderer{},
+        "cards_detailed.txt": CardRenderer{ ShowFares: true, ShowEmissions: true,
+            Loyalty: LoyaltyParams{ Programs: []string{ "AS" }, EstimateMiles: true } },
+        "table.txt": TableRenderer{ ShowFares: true, ShowEmissions: true },
+        "markdown.md": MarkdownRenderer{ ShowFares: true },
+        "report.html": HTMLRenderer{ ShowFares: true, ShowEmissions: true },
+        "results.csv": CSVRenderer{},
+        "results.json": JSONRenderer{},
+    }
+    for name,renderer := range renderers {
+        t.Run(name, func(t *testing.T) {
+            buf := new(bytes.Buffer)
+            if err := renderer.Render(buf, summary, options); err != nil {
+                t.Fatal(err)
+            }
+            CheckGolden(t, "output/" + name, buf.Bytes())
+        })
+    }
+
+}
+
+// The matrix isn't a Renderer, so this goes through the output format instead
+func TestGoldenMatrix(t *testing.T) {
+
+    color.NoColor = true
+    input := GetReplayInput()
+    input.OutputFormat = OUTPUT_MATRIX
+    resList := GetGoldenResults(t)
+    output := CaptureStdout(t, func() {
+        if err := RenderResults(input, input.GetValidDateRanges(nil), resList); err != nil {
+            t.Error(err)
+        }
+    })
+    CheckGolden(t, "output/matrix.txt", []byte(output))
+
+}
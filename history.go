@@ -0,0 +1,341 @@
+package main
+
+import (
+    "database/sql"
+    "encoding/json"
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+    _ "github.com/mattn/go-sqlite3"
+)
+
+const DEFAULT_HISTORY_FILE = "history.db"
+
+const HISTORY_SCHEMA = `
+CREATE TABLE IF NOT EXISTS runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at TEXT NOT NULL,
+    input TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS requests (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id INTEGER NOT NULL REFERENCES runs(id),
+    request TEXT NOT NULL,
+    success INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS options (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id INTEGER NOT NULL REFERENCES runs(id),
+    request_id INTEGER NOT NULL REFERENCES requests(id),
+    price REAL NOT NULL,
+    option TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS requests_run ON requests(run_id);
+CREATE INDEX IF NOT EXISTS options_run ON options(run_id);
+`
+
+type History struct {
+    db *sql.DB
+}
+
+// A search as it was run: its input, and each request with its outcome
+type HistoryRun struct {
+    ID int64
+    CreatedAt time.Time
+    Input InputParams
+    Results []FlightsResult
+}
+
+// Enough about a run to pick it out of a list
+type HistoryRunInfo struct {
+    ID int64
+    CreatedAt time.Time
+    Input InputParams
+    NumRequests int
+    Successes int
+    BestPrice sql.NullFloat64
+}
+
+func OpenHistory(path string) (*History, error) {
+    db, err := sql.Open("sqlite3", path)
+    if err != nil {
+        return nil, err
+    }
+    if _, err := db.Exec(HISTORY_SCHEMA); err != nil {
+        db.Close()
+        return nil, err
+    }
+    return &History{ db: db }, nil
+}
+
+func (h *History) Close() error {
+    return h.db.Close()
+}
+
+/**
+ * Store a run: the input that produced it, every request made and whether it
+ *     succeeded, and the parsed options each request returned.
+ */
+func (h *History) RecordRun(input InputParams, resList []FlightsResult) (
+    runID int64, err error) {
+
+    inputJSON, err := json.Marshal(input)
+    if err != nil {
+        return
+    }
+
+    tx, err := h.db.Begin()
+    if err != nil {
+        return
+    }
+    defer func() {
+        if err != nil {
+            tx.Rollback()
+        } else {
+            err = tx.Commit()
+        }
+    }()
+
+    runRes, err := tx.Exec("INSERT INTO runs (created_at, input) VALUES (?, ?)",
+        time.Now().Format(time.RFC3339), string(inputJSON))
+    if err != nil {
+        return
+    }
+    if runID, err = runRes.LastInsertId(); err != nil {
+        return
+    }
+
+    for _,res := range resList {
+        var requestJSON []byte
+        if requestJSON, err = json.Marshal(res.Request); err != nil {
+            return
+        }
+        var reqRes sql.Result
+        reqRes, err = tx.Exec(
+            "INSERT INTO requests (run_id, request, success) VALUES (?, ?, ?)",
+            runID, string(requestJSON), res.Success)
+        if err != nil {
+            return
+        }
+        var requestID int64
+        if requestID, err = reqRes.LastInsertId(); err != nil {
+            return
+        }
+
+        for _,option := range res.Options {
+            var optionJSON []byte
+            if optionJSON, err = json.Marshal(option); err != nil {
+                return
+            }
+            _, err = tx.Exec(
+                "INSERT INTO options (run_id, request_id, price, option) VALUES (?, ?, ?, ?)",
+                runID, requestID, option.Price, string(optionJSON))
+            if err != nil {
+                return
+            }
+        }
+    }
+    return
+
+}
+
+/**
+ * Past runs, most recent first.
+ */
+func (h *History) ListRuns() (runs []HistoryRunInfo, err error) {
+
+    rows, err := h.db.Query(`
+        SELECT r.id, r.created_at, r.input,
+            (SELECT COUNT(*) FROM requests q WHERE q.run_id = r.id),
+            (SELECT COUNT(*) FROM requests q WHERE q.run_id = r.id AND q.success),
+            (SELECT MIN(price) FROM options o WHERE o.run_id = r.id)
+        FROM runs r ORDER BY r.id DESC`)
+    if err != nil {
+        return
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var run HistoryRunInfo
+        var createdAt, inputJSON string
+        err = rows.Scan(&run.ID, &createdAt, &inputJSON, &run.NumRequests,
+            &run.Successes, &run.BestPrice)
+        if err != nil {
+            return
+        }
+        if run.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+            return
+        }
+        if err = json.Unmarshal([]byte(inputJSON), &run.Input); err != nil {
+            return
+        }
+        runs = append(runs, run)
+    }
+    err = rows.Err()
+    return
+
+}
+
+/**
+ * Load a run with all its requests and options, in the order they were saved.
+ */
+func (h *History) LoadRun(runID int64) (run HistoryRun, err error) {
+
+    var createdAt, inputJSON string
+    err = h.db.QueryRow("SELECT id, created_at, input FROM runs WHERE id = ?",
+        runID).Scan(&run.ID, &createdAt, &inputJSON)
+    if err != nil {
+        return
+    }
+    if run.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+        return
+    }
+    if err = json.Unmarshal([]byte(inputJSON), &run.Input); err != nil {
+        return
+    }
+
+    rows, err := h.db.Query(
+        "SELECT id, request, success FROM requests WHERE run_id = ? ORDER BY id",
+        runID)
+    if err != nil {
+        return
+    }
+    defer rows.Close()
+
+    resultIndexes := make(map[int64]int)
+    for rows.Next() {
+        var requestID int64
+        var requestJSON string
+        var res FlightsResult
+        if err = rows.Scan(&requestID, &requestJSON, &res.Success); err != nil {
+            return
+        }
+        if err = json.Unmarshal([]byte(requestJSON), &res.Request); err != nil {
+            return
+        }
+        resultIndexes[requestID] = len(run.Results)
+        run.Results = append(run.Results, res)
+    }
+    if err = rows.Err(); err != nil {
+        return
+    }
+
+    optionRows, err := h.db.Query(
+        "SELECT request_id, option FROM options WHERE run_id = ? ORDER BY id",
+        runID)
+    if err != nil {
+        return
+    }
+    defer optionRows.Close()
+
+    for optionRows.Next() {
+        var requestID int64
+        var optionJSON string
+        var option FlightsResultOption
+        if err = optionRows.Scan(&requestID, &optionJSON); err != nil {
+            return
+        }
+        if err = json.Unmarshal([]byte(optionJSON), &option); err != nil {
+            return
+        }
+        i := resultIndexes[requestID]
+        run.Results[i].Options = append(run.Results[i].Options, option)
+    }
+    err = optionRows.Err()
+    return
+
+}
+
+/**
+ * Record a finished search. Failing to save isn't fatal, the results are
+ *     still printed.
+ */
+func SaveRun(input InputParams, resList []FlightsResult, config AppConfig) {
+
+    history, err := OpenHistory(config.HistoryFile)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Could not open history database: %s\n", err)
+        return
+    }
+    defer history.Close()
+
+    runID, err := history.RecordRun(input, resList)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Could not save run to history: %s\n", err)
+        return
+    }
+    if err := history.RecordFares(runID, input, resList, time.Now()); err != nil {
+        fmt.Fprintf(os.Stderr, "Could not save fares to history: %s\n", err)
+    }
+    fmt.Fprintf(os.Stderr, "Saved as run %d\n", runID)
+
+}
+
+func ListRunsCommand(config AppConfig) (error) {
+
+    history, err := OpenHistory(config.HistoryFile)
+    if err != nil {
+        return fmt.Errorf("could not open history database: %s", err)
+    }
+    defer history.Close()
+
+    runs, err := history.ListRuns()
+    if err != nil {
+        return fmt.Errorf("could not read history: %s", err)
+    }
+
+    const DATETIME_FMT = "2006-01-02 03:04 PM"
+    for _,run := range runs {
+        best := "-"
+        if run.BestPrice.Valid {
+            best = fmt.Sprintf("$%.2f", run.BestPrice.Float64)
+        }
+        fmt.Printf("%5d  %s  %-24s  %3d/%-3d  %9s\n", run.ID,
+            run.CreatedAt.Local().Format(DATETIME_FMT),
+            DescribeRoute(run.Input), run.Successes, run.NumRequests, best)
+    }
+    return nil
+
+}
+
+/**
+ * Print a stored run again, optionally in a different output format. Nothing
+ *     is written or reloaded: the matrix CSV file isn't touched, and dates
+ *     keep the holiday tags saved with the run.
+ */
+func ShowRunCommand(args []string, config AppConfig) (error) {
+
+    if len(args) == 0 {
+        return fmt.Errorf("usage: show <run id> [format]")
+    }
+    runID, err := strconv.ParseInt(args[0], 10, 64)
+    if err != nil {
+        return fmt.Errorf("could not interpret run id: %s", args[0])
+    }
+
+    history, err := OpenHistory(config.HistoryFile)
+    if err != nil {
+        return fmt.Errorf("could not open history database: %s", err)
+    }
+    defer history.Close()
+
+    run, err := history.LoadRun(runID)
+    if err != nil {
+        return fmt.Errorf("could not load run %d: %s", runID, err)
+    }
+
+    if len(args) > 1 {
+        run.Input.OutputFormat = args[1]
+    }
+    run.Input.MatrixCSVFile = ""
+    return RenderResults(run.Input, GetResultDateRanges(run.Results), run.Results)
+
+}
+
+// Expected Output Format: SFO/SJC -> BOS
+func DescribeRoute(input InputParams) string {
+    return strings.Join(input.GetOriginAirports(), "/") + " -> " +
+        strings.Join(input.GetDestAirports(), "/")
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "sort"
+    "time"
+)
+
+const (
+    SEARCH_FULL        = "full"        // Query every date pair
+    SEARCH_INCREMENTAL = "incremental" // Query a sample, then refine around the cheapest
+)
+
+const DEFAULT_COARSE_STEP = 3
+const DEFAULT_REFINE_COUNT = 3
+
+/**
+ * Two-phase search for wide date windows. The coarse pass queries every
+ *     CoarseStep-th day in each direction, then the fine pass fills in the
+ *     days around the RefineCount cheapest date pairs found so far.
+ *
+ * Both passes together stay within QueryBudget, if one is set.
+ */
+func RunIncrementalSearch(input InputParams, cal *Calendar, config AppConfig) (
+    reqList []FlightsRequest, resList []FlightsResult, err error) {
+
+    step := input.GetCoarseStep()
+    dateRanges := input.GetValidDateRanges(cal)
+
+    // Coarse pass
+    coarseRanges := SampleDateRanges(dateRanges, step)
+    coarseReqs, withinBudget := ApplyQueryBudget(
+        BuildFlightRequestForDates(input, cal, coarseRanges), input, config)
+    if !withinBudget {
+        err = fmt.Errorf("query budget of %d exceeded by coarse pass",
+            input.QueryBudget)
+        return
+    }
+    fmt.Fprintf(os.Stderr, "Coarse pass over %d of %d date pairs:\n",
+        len(coarseRanges), len(dateRanges))
+    PlanQueries(coarseReqs, config).Print()
+
+    // Counted before sending, since sending caches them
+    coarseSent := 0
+    for _,req := range coarseReqs {
+        if config.SendsToQPX(req) {
+            coarseSent++
+        }
+    }
+    reqList = append(reqList, coarseReqs...)
+    coarseResults, err := SendQPXRequests(coarseReqs, config)
+    resList = append(resList, coarseResults...)
+    if err != nil {
+        return
+    }
+
+    // Fine pass
+    limit := -1
+    if input.QueryBudget > 0 {
+        limit = input.QueryBudget - coarseSent
+        if limit < 0 {
+            limit = 0
+        }
+    }
+    fineReqs, found := BuildFineRequests(input, cal, dateRanges, coarseRanges,
+        resList, limit)
+    if len(fineReqs) == 0 {
+        return
+    }
+    fmt.Fprintf(os.Stderr, "Fine pass sending %d of %d requests near the cheapest results:\n",
+        len(fineReqs), found)
+    PlanQueries(fineReqs, config).Print()
+
+    reqList = append(reqList, fineReqs...)
+    fineResults, err := SendQPXRequests(fineReqs, config)
+    resList = append(resList, fineResults...)
+    return
+
+}
+
+/**
+ * Requests for the unqueried date pairs around the cheapest coarse results,
+ *     closest to them first, so that a budget cut drops the least promising
+ *     dates. Limited to limit requests unless it's negative; found is how many
+ *     there were before that.
+ */
+func BuildFineRequests(input InputParams, cal *Calendar, dateRanges,
+    coarseRanges [][]time.Time, coarseResults []FlightsResult, limit int) (
+    fineReqs []FlightsRequest, found int) {
+
+    step := input.GetCoarseStep()
+    cheapest := GetCheapestDateRanges(coarseResults, input.Ranking,
+        input.GetRefineCount())
+    fineRanges := GetNeighborDateRanges(dateRanges, cheapest, step-1, coarseRanges)
+    fineReqs = BuildFlightRequestForDates(input, cal, fineRanges)
+    found = len(fineReqs)
+
+    sort.SliceStable(fineReqs, func(i, j int) bool {
+        return GetDistanceInDays(fineReqs[i], cheapest) <
+            GetDistanceInDays(fineReqs[j], cheapest)
+    })
+
+    if limit >= 0 && len(fineReqs) > limit {
+        fineReqs = fineReqs[:limit]
+    }
+    return
+
+}
+
+/**
+ * Days between a request's dates and the nearest of the centers, counting
+ *     both directions.
+ */
+func GetDistanceInDays(req FlightsRequest, centers [][]time.Time) (distance int) {
+    for i,center := range centers {
+        d := AbsInt(DaysBetween(center[0], req.Slices[0].Date)) +
+            AbsInt(DaysBetween(center[1], req.Slices[1].Date))
+        if i == 0 || d < distance {
+            distance = d
+        }
+    }
+    return
+}
+
+func (input InputParams) GetCoarseStep() int {
+    if input.CoarseStep > 0 {
+        return input.CoarseStep
+    }
+    return DEFAULT_COARSE_STEP
+}
+
+func (input InputParams) GetRefineCount() int {
+    if input.RefineCount > 0 {
+        return input.RefineCount
+    }
+    return DEFAULT_REFINE_COUNT
+}
+
+/**
+ * Keep the date pairs whose outbound and inbound dates both land on a
+ *     multiple of step days from the earliest date in that direction.
+ *
+ * Trip length limits can make that grid empty, in which case every step-th
+ *     pair is used instead.
+ */
+func SampleDateRanges(dateRanges [][]time.Time, step int) (sampled [][]time.Time) {
+
+    if len(dateRanges) == 0 || step <= 1 {
+        return dateRanges
+    }
+
+    firstOutbound, firstInbound := dateRanges[0][0], dateRanges[0][1]
+    for _,dateRange := range dateRanges {
+        if dateRange[0].Before(firstOutbound) {
+            firstOutbound = dateRange[0]
+        }
+        if dateRange[1].Before(firstInbound) {
+            firstInbound = dateRange[1]
+        }
+    }
+
+    for _,dateRange := range dateRanges {
+        if DaysBetween(firstOutbound, dateRange[0]) % step == 0 &&
+            DaysBetween(firstInbound, dateRange[1]) % step == 0 {
+            sampled = append(sampled, dateRange)
+        }
+    }
+
+    if len(sampled) == 0 {
+        for i := 0; i < len(dateRanges); i += step {
+            sampled = append(sampled, dateRanges[i])
+        }
+    }
+    return
+
+}
+
+/**
+ * The date pairs of the n cheapest successful results, cheapest first.
+ */
+func GetCheapestDateRanges(resList []FlightsResult, ranking RankingParams, n int) (
+    cheapest [][]time.Time) {
+
+    bestPrices := GetBestPriceByDates(resList, ranking)
+    var keys [][2]time.Time
+    for key := range bestPrices {
+        keys = append(keys, key)
+    }
+    sort.Slice(keys, func(i, j int) bool {
+        if bestPrices[keys[i]] == bestPrices[keys[j]] {
+            return keys[i][0].Before(keys[j][0])
+        }
+        return bestPrices[keys[i]] < bestPrices[keys[j]]
+    })
+
+    for i := 0; i < Min(len(keys), n); i++ {
+        cheapest = append(cheapest, []time.Time{ keys[i][0], keys[i][1] })
+    }
+    return
+
+}
+
+/**
+ * Lowest price found for each (outbound date, inbound date) pair, bag fees
+ *     included, among the options the ranking allows.
+ */
+func GetBestPriceByDates(resList []FlightsResult, ranking RankingParams) (
+    map[[2]time.Time]float64) {
+
+    bestPrices := make(map[[2]time.Time]float64)
+    for _,res := range resList {
+        key := [2]time.Time{ res.Request.Slices[0].Date, res.Request.Slices[1].Date }
+        for _,option := range res.Options {
+            if !ranking.Allows(option) {
+                continue
+            }
+            price := option.GetEffectivePrice()
+            if best, ok := bestPrices[key]; !ok || price < best {
+                bestPrices[key] = price
+            }
+        }
+    }
+    return bestPrices
+
+}
+
+/**
+ * Date pairs within radius days of any of the centers in both directions,
+ *     skipping those that were already queried. Pairs near the first center
+ *     come first.
+ */
+func GetNeighborDateRanges(dateRanges, centers [][]time.Time, radius int,
+    queried [][]time.Time) (neighbors [][]time.Time) {
+
+    seen := make(map[[2]time.Time]bool)
+    for _,dateRange := range queried {
+        seen[[2]time.Time{ dateRange[0], dateRange[1] }] = true
+    }
+
+    for _,center := range centers {
+        for _,dateRange := range dateRanges {
+            key := [2]time.Time{ dateRange[0], dateRange[1] }
+            if seen[key] {
+                continue
+            }
+            if AbsInt(DaysBetween(center[0], dateRange[0])) <= radius &&
+                AbsInt(DaysBetween(center[1], dateRange[1])) <= radius {
+                seen[key] = true
+                neighbors = append(neighbors, dateRange)
+            }
+        }
+    }
+    return
+
+}
+
+func DaysBetween(start, end time.Time) int {
+    return int(end.Sub(start).Hours() / 24)
+}
+
+func AbsInt(x int) int {
+    if x < 0 {
+        return -x
+    }
+    return x
+}
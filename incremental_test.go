@@ -0,0 +1,92 @@
+package main
+
+import (
+    "testing"
+    "time"
+)
+
+/**
+ * With the budget only covering some of the fine pass, the requests kept
+ *     should be the ones closest to the cheapest coarse result, from every
+ *     airport, rather than whichever were built first.
+ */
+func TestBuildFineRequestsKeepsClosestDates(t *testing.T) {
+
+    input := InputParams{
+        OriginAirports: []string{ "SFO", "OAK" },
+        DestAirport: "BOS",
+        ReturnAirports: RETURN_MIRROR,
+        Outbound: DirectionParams{ DateRange: [2]string{ "2017-03-01", "2017-03-09" } },
+        Inbound: DirectionParams{ DateRange: [2]string{ "2017-03-20", "2017-03-28" } },
+        NumPassengers: 1,
+        CoarseStep: 3,
+        RefineCount: 1,
+    }
+    dateRanges := input.GetValidDateRanges(nil)
+    coarseRanges := SampleDateRanges(dateRanges, input.GetCoarseStep())
+
+    // Fake coarse results, cheapest on Mar 4 - Mar 23
+    var coarseResults []FlightsResult
+    for _,req := range BuildFlightRequestForDates(input, nil, coarseRanges) {
+        price := 500.0
+        if req.Slices[0].Date.Day() == 4 && req.Slices[1].Date.Day() == 23 {
+            price = 100.0
+        }
+        coarseResults = append(coarseResults, FlightsResult{
+            Request: req,
+            Success: true,
+            Options: []FlightsResultOption{{ Price: price }},
+        })
+    }
+
+    fineReqs, found := BuildFineRequests(input, nil, dateRanges, coarseRanges,
+        coarseResults, 8)
+    if len(fineReqs) != 8 || found <= 8 {
+        t.Fatalf("got %d of %d requests, want 8 of more", len(fineReqs), found)
+    }
+    center := [][]time.Time{{ DateStringToTime("2017-03-04"), DateStringToTime("2017-03-23") }}
+    origins := make(map[string]int)
+    for _,req := range fineReqs {
+        if d := GetDistanceInDays(req, center); d != 1 {
+            t.Errorf("%s is %d days from the cheapest dates, want 1",
+                DescribeRequest(req), d)
+        }
+        origins[req.Slices[0].Origin]++
+    }
+    if origins["SFO"] != 4 || origins["OAK"] != 4 {
+        t.Errorf("got requests from %v, want 4 from each airport", origins)
+    }
+
+    if all, _ := BuildFineRequests(input, nil, dateRanges, coarseRanges,
+        coarseResults, -1); len(all) != found {
+        t.Errorf("got %d requests without a limit, want %d", len(all), found)
+    }
+
+}
+
+func TestGetBestPriceByDates(t *testing.T) {
+
+    options := GetBrowserTestOptions()
+    options[1].BagFees, options[1].EffectivePrice = 150, 350
+    cheap := BrowserTestOption(250, FlightsResultSegment{ MarketingCarrier: "DL" })
+    res := FlightsResult{ Success: true, Options: append(options, cheap) }
+    res.Request.Slices[0].Date = DateStringToTime("2017-03-29")
+    res.Request.Slices[1].Date = DateStringToTime("2017-04-02")
+    key := [2]time.Time{ res.Request.Slices[0].Date, res.Request.Slices[1].Date }
+
+    for _,test := range []struct {
+        ranking RankingParams
+        want float64
+    }{
+        { RankingParams{}, 250 },
+        { RankingParams{ BlockedAirlines: []string{ "DL" } }, 300 },
+        { RankingParams{ BlockedAirlines: []string{ "DL", "UA" } }, 350 },
+    } {
+        if got := GetBestPriceByDates([]FlightsResult{ res }, test.ranking)[key];
+            got != test.want {
+            t.Errorf("blocking %q: got $%.2f, want $%.2f", test.ranking.BlockedAirlines,
+                got, test.want)
+        }
+    }
+
+}
@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 /*var Input = InputParams{
     OriginAirports: []string{"SFO", "SJC"},
     DestAirport: "BOS",
@@ -43,4 +45,43 @@ var Input = InputParams{
     NumPassengers: 1,
     DryRun: false,
     CacheOK: true,
-}
\ No newline at end of file
+}
+
+/*var Watches = []Watch{
+    {
+        Name: "Boston for Thanksgiving",
+        Input: InputParams{
+            OriginAirports: []string{"SFO", "SJC"},
+            DestAirport: "BOS",
+            ReturnAirports: RETURN_ONE_END,
+            Outbound: DirectionParams{
+                DateRange: [2]string{"2017-11-21", "2017-11-22"},
+            },
+            Inbound: DirectionParams{
+                DateRange: [2]string{"2017-11-26", "2017-11-27"},
+            },
+            NumPassengers: 1,
+        },
+        TargetPrice: 350,
+        DropPercent: 10,
+        Interval: time.Hour * 12,
+        Notifiers: []Notifier{
+            WebhookNotifier{ URL: "https://hooks.slack.com/services/..." },
+            SMTPNotifier{
+                Addr: "smtp.example.com:587",
+                Username: "flights@example.com",
+                Password: "...",
+                From: "flights@example.com",
+                To: []string{"me@example.com"},
+            },
+            CommandNotifier{ Command: []string{"notify-send", "Fare alert"} },
+        },
+    },
+}*/
+
+var Watches = []Watch{}
+
+var Daemon = DaemonParams{
+    DailyQueryBudget: 50,
+    CacheTTL: time.Hour * 3,
+}
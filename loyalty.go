@@ -0,0 +1,100 @@
+package main
+
+import (
+    "math"
+    "strings"
+    "github.com/StephensAndrewM/FlightFinder/refdata"
+)
+
+// Distance-based programs credit at least this much for a short flight
+const MIN_MILES_PER_SEGMENT = 500
+
+/**
+ * Frequent flyer programs we want to earn on. A program earns on its own
+ *     airline and on the rest of its alliance; alliances listed directly earn
+ *     on any member.
+ */
+type LoyaltyParams struct {
+    Programs []string // Carrier codes, e.g. "AS" for Mileage Plan
+    Alliances []string // e.g. "oneworld", "SkyTeam", "Star Alliance"
+
+    // Show roughly how many miles each option would earn next to its price
+    EstimateMiles bool
+}
+
+func (loyalty LoyaltyParams) IsEmpty() bool {
+    return len(loyalty.Programs) == 0 && len(loyalty.Alliances) == 0
+}
+
+/**
+ * Whether a segment earns on any of the programs. Credit goes by the airline
+ *     selling the flight.
+ */
+func (loyalty LoyaltyParams) Earns(segment FlightsResultSegment) bool {
+    code := segment.GetCarrierCode()
+    if ContainsFold(loyalty.Programs, code) {
+        return true
+    }
+    airline, ok := refdata.LookupAirline(code)
+    if !ok || len(airline.Alliance) == 0 {
+        return false
+    }
+    if ContainsFold(loyalty.Alliances, airline.Alliance) {
+        return true
+    }
+    for _,program := range loyalty.Programs {
+        if partner, ok := refdata.LookupAirline(program); ok &&
+            strings.EqualFold(partner.Alliance, airline.Alliance) {
+            return true
+        }
+    }
+    return false
+}
+
+// Segments that don't earn on any of the programs
+func (loyalty LoyaltyParams) GetUnearnedSegments(option FlightsResultOption) (
+    count int) {
+
+    for _,slice := range option.Slices {
+        for _,segment := range slice.Segments {
+            if !loyalty.Earns(segment) {
+                count++
+            }
+        }
+    }
+    return
+
+}
+
+/**
+ * Rough miles earned: the great-circle distance of each earning segment, with
+ *     the usual minimum per segment. Fare class bonuses and revenue-based
+ *     programs aren't taken into account. Not ok if an airport's location
+ *     isn't known.
+ */
+func (loyalty LoyaltyParams) EstimateMilesEarned(option FlightsResultOption) (
+    miles float64, ok bool) {
+
+    for _,slice := range option.Slices {
+        for _,segment := range slice.Segments {
+            if !loyalty.Earns(segment) {
+                continue
+            }
+            if segment.Distance == 0 && !segment.ApplyDistance() {
+                return 0, false
+            }
+            miles += math.Max(segment.Distance, MIN_MILES_PER_SEGMENT)
+        }
+    }
+    return miles, true
+
+}
+
+func ContainsFold(list []string, item string) bool {
+    for _,existing := range list {
+        if strings.EqualFold(existing, item) {
+            return true
+        }
+    }
+    return false
+}
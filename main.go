@@ -4,7 +4,8 @@ import (
     "time"
     // "github.com/davecgh/go-spew/spew"
     "fmt"
-    "sort"
+    "os"
+    "github.com/StephensAndrewM/FlightFinder/refdata"
 )
 
 
@@ -15,31 +16,202 @@ func main() {
     config := AppConfig{
         DryRun: Input.DryRun,
         CacheOK: Input.CacheOK,
+        HistoryFile: Input.GetHistoryFile(),
+        RecordDir: Input.RecordDir,
+        ReplayDir: Input.ReplayDir,
     }
+    LoadReferenceData(Input)
 
-    reqList := BuildFlightRequest(Input)
-    resList := MakeParallelQPXRequests(reqList, config)
-    options, successes := FlattenResponses(resList)
+    if len(os.Args) > 1 {
+        RunCommand(os.Args[1], os.Args[2:], config)
+    } else {
+        RunSearchCommand(Input, config)
+    }
+
+}
+
+func RunCommand(command string, args []string, config AppConfig) {
+    var err error
+    switch command {
+    case "search":
+        RunSearchCommand(Input, config)
+    case "history":
+        err = ListRunsCommand(config)
+    case "show":
+        err = ShowRunCommand(args, config)
+    case "fares":
+        err = FareHistoryCommand(args, config)
+    case "daemon":
+        RunDaemonCommand(config)
+    case "serve":
+        RunServerCommand(args, config)
+    default:
+        fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
+        fmt.Fprintln(os.Stderr, "Commands: search, history, show <run id> [format], fares [run id], daemon, serve [addr]")
+        os.Exit(1)
+    }
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%s: %s\n", command, err)
+        os.Exit(1)
+    }
+}
+
+// Replace the embedded airport and airline data if newer files are given
+func LoadReferenceData(input InputParams) {
+    if len(input.AirportsFile) > 0 {
+        if err := refdata.LoadAirportsFile(input.AirportsFile); err != nil {
+            fmt.Fprintf(os.Stderr, "Could not load airports: %s\n", err)
+            os.Exit(1)
+        }
+    }
+    if len(input.AirlinesFile) > 0 {
+        if err := refdata.LoadAirlinesFile(input.AirlinesFile); err != nil {
+            fmt.Fprintf(os.Stderr, "Could not load airlines: %s\n", err)
+            os.Exit(1)
+        }
+    }
+}
+
+/**
+ * Run the search described by the input, save it to the history and print
+ *     the results.
+ */
+func RunSearchCommand(input InputParams, config AppConfig) {
+
+    if err := input.Validate(); err != nil {
+        fmt.Fprintf(os.Stderr, "Invalid input: %s\n", err)
+        os.Exit(1)
+    }
+    for _,airport := range input.GetUnknownAirports() {
+        fmt.Fprintf(os.Stderr, "Warning: %s is not a known airport\n", airport)
+    }
+    cal, err := input.LoadCalendar()
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Invalid input: %s\n", err)
+        os.Exit(1)
+    }
+
+    resList, err := RunSearch(input, cal, config)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Search failed: %s\n", err)
+        os.Exit(1)
+    }
+
+    if !config.DryRun {
+        SaveRun(input, resList, config)
+    }
+
+    if err := RenderResults(input, input.GetValidDateRanges(cal), resList); err != nil {
+        fmt.Fprintf(os.Stderr, "Error writing results: %s\n", err)
+        os.Exit(1)
+    }
+
+}
+
+/**
+ * Print the results in the input's output format. The date pairs lay out the
+ *     price matrix.
+ */
+func RenderResults(input InputParams, dateRanges [][]time.Time,
+    resList []FlightsResult) (error) {
+
+    options, successes := FlattenResponses(resList, input.Ranking)
+
+    if len(input.MatrixCSVFile) > 0 {
+        err := BuildPriceMatrix(dateRanges, resList, input.Ranking).SaveCSV(
+            input.MatrixCSVFile)
+        if err != nil {
+            return fmt.Errorf("matrix CSV file: %s", err)
+        }
+    }
+
+    summary := SearchSummary{
+        AttemptedRequests: len(resList),
+        Successes: successes,
+        Warnings: CollectWarnings(resList),
+    }
+    if input.OutputFormat == OUTPUT_MATRIX {
+        PrintSummary(os.Stdout, summary)
+        return BuildPriceMatrix(dateRanges, resList, input.Ranking).Print(os.Stdout)
+    }
+
+    return GetRenderer(input).Render(os.Stdout, summary, options)
+
+}
+
+/**
+ * Run a search in whichever mode the input asks for. Fails without sending
+ *     anything if the search doesn't fit the query budget, and partway through
+ *     if a replay is missing a request. The calendar is the one loaded from
+ *     the input, if any.
+ */
+func RunSearch(input InputParams, cal *Calendar, config AppConfig) (
+    resList []FlightsResult, err error) {
 
-    PrintResults(options, len(reqList), successes)
+    if input.SearchMode == SEARCH_INCREMENTAL {
+        _, resList, err = RunIncrementalSearch(input, cal, config)
+    } else {
+        _, resList, err = RunFullSearch(input, cal, config)
+    }
+    return
 
 }
 
-func BuildFlightRequest(input InputParams) (reqList []FlightsRequest) {
+/**
+ * Query every combination of airports and dates, subject to the query budget.
+ */
+func RunFullSearch(input InputParams, cal *Calendar, config AppConfig) (
+    reqList []FlightsRequest, resList []FlightsResult, err error) {
+
+    reqList = BuildFlightRequest(input, cal)
+    plan := PlanQueries(reqList, config)
+    plan.Print()
+
+    reqList, withinBudget := ApplyQueryBudget(reqList, input, config)
+    if !withinBudget {
+        err = fmt.Errorf("query budget of %d exceeded", input.QueryBudget)
+        return
+    }
+    if len(reqList) < plan.NumRequests {
+        fmt.Fprintf(os.Stderr, "Trimmed to fit query budget of %d:\n", input.QueryBudget)
+        PlanQueries(reqList, config).Print()
+    }
+
+    resList, err = SendQPXRequests(reqList, config)
+    return
+
+}
+
+func BuildFlightRequest(input InputParams, cal *Calendar) (reqList []FlightsRequest) {
+    return BuildFlightRequestForDates(input, cal, input.GetValidDateRanges(cal))
+}
+
+/**
+ * Cross every allowed airport combination with the given date pairs.
+ */
+func BuildFlightRequestForDates(input InputParams, cal *Calendar,
+    dateRanges [][]time.Time) (reqList []FlightsRequest) {
 
     for _,outboundOrigin := range input.GetOriginAirports() {
         for _,outboundDest := range input.GetDestAirports() {
             for _,inboundOrigin := range input.GetDestAirports() {
                 for _,inboundDest := range input.GetOriginAirports() {
-                    for _,dateRange := range input.GetValidDateRanges() {
+                    if !input.AllowsReturnAirports(outboundOrigin, outboundDest,
+                        inboundOrigin, inboundDest) {
+                        continue
+                    }
+                    for _,dateRange := range dateRanges {
                         var req FlightsRequest
                         req.NumPassengers = input.NumPassengers
+                        req.CheckedBags = input.CheckedBags
+                        req.CarryOnBags = input.CarryOnBags
                         req.Slices[0] = FlightsRequestSlice{
                             Origin: outboundOrigin,
                             Destination: outboundDest,
                             Date: dateRange[0],
                             TimeBounds: input.Outbound.GetTimeRange(),
                             MaxLegs: input.Outbound.GetMaxLegs(),
+                            DateTags: input.GetDateTags(cal, dateRange[0]),
                         }
                         req.Slices[1] = FlightsRequestSlice{
                             Origin: inboundOrigin,
@@ -47,6 +219,7 @@ func BuildFlightRequest(input InputParams) (reqList []FlightsRequest) {
                             Date: dateRange[1],
                             TimeBounds: input.Inbound.GetTimeRange(),
                             MaxLegs: input.Inbound.GetMaxLegs(),
+                            DateTags: input.GetDateTags(cal, dateRange[1]),
                         }
                         // spew.Dump(req)
                         reqList = append(reqList, req)
@@ -58,6 +231,25 @@ func BuildFlightRequest(input InputParams) (reqList []FlightsRequest) {
     return
 }
 
+/**
+ * Send the requests to QPX, or answer them from recordings when replaying.
+ *     Only a replay can fail, when a request wasn't recorded.
+ */
+func SendQPXRequests(reqList []FlightsRequest, config AppConfig) (
+    resList []FlightsResult, err error) {
+
+    resList = MakeParallelQPXRequests(reqList, config)
+    if len(config.ReplayDir) > 0 {
+        err = CheckReplayResults(resList)
+    }
+    return
+
+}
+
+// Shared by every search in the process, so concurrent searches (as in the
+//     server) don't add up to more than the QPX rate limit
+var qpxLimiter = time.Tick(QPX_REQUEST_INTERVAL)
+
 /**
  * Given a list of requests to make, perform them in parallel and return
  *     once all results are in.
@@ -69,18 +261,30 @@ func MakeParallelQPXRequests(reqList []FlightsRequest, config AppConfig) (
 
     c := make(chan FlightsResult, len(reqList))
     processed := 0
-    limiter := time.Tick(time.Millisecond * 200)
+    config.ReportProgress(ProgressEvent{ Type: PROGRESS_PLANNED, Total: len(reqList) })
 
-    for _,req := range reqList {
-        <-limiter  // Don't overload QPX
-        go ParallelQPXRequestHandler(req, config, c)
-    }
+    // Send from a separate goroutine so responses are reported as they arrive
+    go func() {
+        for _,req := range reqList {
+            if config.SendsToQPX(req) {
+                <-qpxLimiter  // Don't overload QPX
+            }
+            config.ReportProgress(ProgressEvent{ Type: PROGRESS_STARTED, Request: req })
+            go ParallelQPXRequestHandler(req, config, c)
+        }
+    }()
 
     for i := 0; i < len(reqList); i++ {
         res := <-c
         resList = append(resList, res)
         processed++
-        fmt.Printf("Received %d Out of %d Responses\n", processed, len(reqList))
+        fmt.Fprintf(os.Stderr, "Received %d Out of %d Responses\n", processed, len(reqList))
+
+        event := ProgressEvent{ Type: PROGRESS_SUCCEEDED, Request: res.Request, Result: res }
+        if !res.Success {
+            event.Type = PROGRESS_FAILED
+        }
+        config.ReportProgress(event)
     }
 
     return
@@ -95,19 +299,38 @@ func ParallelQPXRequestHandler(req FlightsRequest, config AppConfig,
     c chan FlightsResult) {
 
     qpxReq := BuildQPXRequest(req)
-    qpxRes, success := MakeQPXRequest(qpxReq, config)
+    qpxRes, success, reason := MakeQPXRequest(qpxReq, config)
     res := InterpretQPXResult(qpxRes, success)
+    res.Request = req
+    res.Error = reason
+    res.ApplyBagFees(req)
+    for i := range res.Options {
+        for j := 0; j < 2; j++ {
+            res.Options[i].Slices[j].DateTags = req.Slices[j].DateTags
+        }
+    }
     c <- res
 
 }
 
 
 
+// Parser warnings from every response, labelled with the request they're from
+func CollectWarnings(resList []FlightsResult) (warnings []string) {
+    for _,result := range resList {
+        for _,warning := range result.Warnings {
+            warnings = append(warnings,
+                DescribeRequest(result.Request) + ": " + warning)
+        }
+    }
+    return
+}
+
 /**
  * Transform a list of objects containing lists of flight options to just one 
- *     list of flight options.
+ *     list of flight options, filtered and ordered by the ranking.
  */
-func FlattenResponses(resList []FlightsResult) (
+func FlattenResponses(resList []FlightsResult, ranking RankingParams) (
     optionsList FlightsResultOptionList, successes int) {
 
     for _,result := range resList {
@@ -116,7 +339,7 @@ func FlattenResponses(resList []FlightsResult) (
             optionsList = append(optionsList, result.Options...)
         }
     }
-    sort.Sort(optionsList)
+    optionsList = ranking.Rank(optionsList)
     return
 
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+    "bytes"
+    "encoding/csv"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "strconv"
+    "time"
+    "github.com/fatih/color"
+)
+
+// Cells within this fraction of the cheapest price are also highlighted
+const MATRIX_NEAR_CHEAPEST = 0.10
+
+type PriceMatrix struct {
+    OutboundDates []time.Time
+    InboundDates []time.Time
+    Prices map[[2]time.Time]float64
+}
+
+/**
+ * Lay out the cheapest price the ranking allows for each date pair, bag fees
+ *     included. Rows and columns cover all the valid dates, even those that
+ *     weren't queried or had no results.
+ */
+func BuildPriceMatrix(dateRanges [][]time.Time, resList []FlightsResult,
+    ranking RankingParams) (matrix PriceMatrix) {
+
+    outboundSeen := make(map[time.Time]bool)
+    inboundSeen := make(map[time.Time]bool)
+    for _,dateRange := range dateRanges {
+        if !outboundSeen[dateRange[0]] {
+            outboundSeen[dateRange[0]] = true
+            matrix.OutboundDates = append(matrix.OutboundDates, dateRange[0])
+        }
+        if !inboundSeen[dateRange[1]] {
+            inboundSeen[dateRange[1]] = true
+            matrix.InboundDates = append(matrix.InboundDates, dateRange[1])
+        }
+    }
+    sort.Slice(matrix.OutboundDates, func(i, j int) bool {
+        return matrix.OutboundDates[i].Before(matrix.OutboundDates[j])
+    })
+    sort.Slice(matrix.InboundDates, func(i, j int) bool {
+        return matrix.InboundDates[i].Before(matrix.InboundDates[j])
+    })
+
+    matrix.Prices = GetBestPriceByDates(resList, ranking)
+    return
+
+}
+
+/**
+ * The date pairs that were queried, in the order they were sent. Used to lay
+ *     out the matrix for a saved run without rebuilding its date pairs.
+ */
+func GetResultDateRanges(resList []FlightsResult) (dateRanges [][]time.Time) {
+    seen := make(map[[2]time.Time]bool)
+    for _,res := range resList {
+        key := [2]time.Time{ res.Request.Slices[0].Date, res.Request.Slices[1].Date }
+        if !seen[key] {
+            seen[key] = true
+            dateRanges = append(dateRanges, key[:])
+        }
+    }
+    return
+}
+
+func (matrix PriceMatrix) GetPrice(outbound, inbound time.Time) (float64, bool) {
+    price, ok := matrix.Prices[[2]time.Time{ outbound, inbound }]
+    return price, ok
+}
+
+func (matrix PriceMatrix) GetCheapestPrice() (cheapest float64, ok bool) {
+    for _,price := range matrix.Prices {
+        if !ok || price < cheapest {
+            cheapest = price
+            ok = true
+        }
+    }
+    return
+}
+
+/**
+ * Outbound dates down the side, inbound dates across the top.
+ */
+func (matrix PriceMatrix) Print(w io.Writer) error {
+
+    const DATE_FMT = "Mon 01/02"
+    const CELL_WIDTH = 11
+    headerFont := color.New(color.FgCyan, color.Bold)
+    costFont := color.New(color.FgYellow, color.Bold)
+    nearCostFont := color.New(color.FgGreen, color.Bold)
+    buf := new(bytes.Buffer)
+
+    cheapest, hasCheapest := matrix.GetCheapestPrice()
+
+    fmt.Fprintf(buf, "%-*s", CELL_WIDTH, "Out \\ In")
+    for _,inbound := range matrix.InboundDates {
+        headerFont.Fprintf(buf, "%*s", CELL_WIDTH, inbound.Format(DATE_FMT))
+    }
+    fmt.Fprintf(buf, "\n")
+
+    for _,outbound := range matrix.OutboundDates {
+        headerFont.Fprintf(buf, "%-*s", CELL_WIDTH, outbound.Format(DATE_FMT))
+        for _,inbound := range matrix.InboundDates {
+            price, ok := matrix.GetPrice(outbound, inbound)
+            if !ok {
+                fmt.Fprintf(buf, "%*s", CELL_WIDTH, "-")
+                continue
+            }
+            cell := fmt.Sprintf("%*s", CELL_WIDTH, fmt.Sprintf("$%.2f", price))
+            if hasCheapest && price == cheapest {
+                costFont.Fprintf(buf, "%s", cell)
+            } else if hasCheapest && price <= cheapest*(1+MATRIX_NEAR_CHEAPEST) {
+                nearCostFont.Fprintf(buf, "%s", cell)
+            } else {
+                fmt.Fprintf(buf, "%s", cell)
+            }
+        }
+        fmt.Fprintf(buf, "\n")
+    }
+
+    _, err := buf.WriteTo(w)
+    return err
+
+}
+
+/**
+ * Write the matrix as CSV, with the same layout as the terminal grid and
+ *     empty cells for date pairs without a price.
+ */
+func (matrix PriceMatrix) SaveCSV(path string) error {
+
+    const DATE_FMT = "2006-01-02"
+
+    file, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    w := csv.NewWriter(file)
+    header := []string{ "outbound" }
+    for _,inbound := range matrix.InboundDates {
+        header = append(header, inbound.Format(DATE_FMT))
+    }
+    w.Write(header)
+
+    for _,outbound := range matrix.OutboundDates {
+        row := []string{ outbound.Format(DATE_FMT) }
+        for _,inbound := range matrix.InboundDates {
+            if price, ok := matrix.GetPrice(outbound, inbound); ok {
+                row = append(row, strconv.FormatFloat(price, 'f', 2, 64))
+            } else {
+                row = append(row, "")
+            }
+        }
+        w.Write(row)
+    }
+
+    w.Flush()
+    if err := w.Error(); err != nil {
+        return err
+    }
+    return file.Close()
+
+}
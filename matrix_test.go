@@ -0,0 +1,78 @@
+package main
+
+import (
+    "bytes"
+    "io/ioutil"
+    "path/filepath"
+    "testing"
+    "time"
+    "github.com/fatih/color"
+)
+
+// Two outbound and two inbound dates, with nothing found for the last pair.
+//     The cheapest fare on the 30th isn't the cheapest once its bag fees are in.
+func GetMatrixTestData() (dateRanges [][]time.Time, resList []FlightsResult) {
+    withBags := BrowserTestOption(190, FlightsResultSegment{ MarketingCarrier: "AS" })
+    withBags.BagFees, withBags.EffectivePrice = 60, 250
+    for _,pair := range []struct {
+        outbound, inbound string
+        options FlightsResultOptionList
+    }{
+        { "2017-03-29", "2017-04-02", GetBrowserTestOptions() },
+        { "2017-03-29", "2017-04-03", FlightsResultOptionList{
+            BrowserTestOption(180, FlightsResultSegment{ MarketingCarrier: "WN" }) } },
+        { "2017-03-30", "2017-04-02", FlightsResultOptionList{
+            withBags,
+            BrowserTestOption(215, FlightsResultSegment{ MarketingCarrier: "DL" }) } },
+        { "2017-03-30", "2017-04-03", nil },
+    } {
+        var res FlightsResult
+        res.Request.Slices[0].Date = DateStringToTime(pair.outbound)
+        res.Request.Slices[1].Date = DateStringToTime(pair.inbound)
+        res.Success = len(pair.options) > 0
+        res.Options = pair.options
+        dateRanges = append(dateRanges,
+            []time.Time{ res.Request.Slices[0].Date, res.Request.Slices[1].Date })
+        resList = append(resList, res)
+    }
+    return
+}
+
+func TestPriceMatrix(t *testing.T) {
+
+    dateRanges, resList := GetMatrixTestData()
+    ranking := RankingParams{ BlockedAirlines: []string{ "WN" } }
+    matrix := BuildPriceMatrix(dateRanges, resList, ranking)
+
+    color.NoColor = true
+    buf := new(bytes.Buffer)
+    if err := matrix.Print(buf); err != nil {
+        t.Fatal(err)
+    }
+    want := "Out \\ In     Sun 04/02  Mon 04/03\n" +
+        "Wed 03/29      $200.00          -\n" +
+        "Thu 03/30      $215.00          -\n"
+    if buf.String() != want {
+        t.Errorf("got matrix:\n%s\nwant:\n%s", buf.String(), want)
+    }
+
+    path := filepath.Join(t.TempDir(), "matrix.csv")
+    if err := BuildPriceMatrix(dateRanges, resList, RankingParams{}).SaveCSV(path); err != nil {
+        t.Fatal(err)
+    }
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want = "outbound,2017-04-02,2017-04-03\n" +
+        "2017-03-29,200.00,180.00\n" +
+        "2017-03-30,215.00,\n"
+    if string(data) != want {
+        t.Errorf("got CSV:\n%s\nwant:\n%s", data, want)
+    }
+
+    if err := matrix.SaveCSV(filepath.Join(t.TempDir(), "missing", "matrix.csv")); err == nil {
+        t.Error("unwritable CSV file wasn't reported")
+    }
+
+}
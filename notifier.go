@@ -0,0 +1,179 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/smtp"
+    "os"
+    "os/exec"
+    "regexp"
+    "strings"
+    "time"
+)
+
+/**
+ * Somewhere to send an alert when a watch finds a good fare.
+ */
+type Notifier interface {
+    Notify(alert Alert) error
+}
+
+// What webhooks and command hooks receive. The text field is what Slack
+//     shows; other consumers can use the structured fields.
+type AlertPayload struct {
+    Text string                 `json:"text"`
+    Watch string                `json:"watch"`
+    Reason string               `json:"reason"`
+    Price float64               `json:"price"`
+    PreviousPrice *float64      `json:"previous_price"`
+    Option ExportOption         `json:"option"`
+}
+
+func NewAlertPayload(alert Alert) (payload AlertPayload) {
+    payload.Text = alert.GetSubject() + "\n" + alert.GetSummary()
+    payload.Watch = alert.WatchName
+    payload.Reason = alert.Reason
+    payload.Price = alert.Option.GetEffectivePrice()
+    if alert.HasPreviousPrice {
+        previous := alert.PreviousPrice
+        payload.PreviousPrice = &previous
+    }
+    payload.Option = NewExportOption(1, alert.Option)
+    return
+}
+
+func (alert Alert) GetSubject() string {
+    return fmt.Sprintf("Fare alert for %s: $%.2f", alert.WatchName,
+        alert.Option.GetEffectivePrice())
+}
+
+// Expected Output Format: one line per slice, as in the table renderer
+func (alert Alert) GetSummary() string {
+    return alert.Reason + "\n" +
+        "Outbound: " + DescribeSlice(alert.Option.Slices[0]) + "\n" +
+        "Inbound:  " + DescribeSlice(alert.Option.Slices[1])
+}
+
+/**
+ * Print the alert, then pass it to every notifier. A failing notifier
+ *     doesn't stop the others.
+ */
+func SendAlert(alert Alert, notifiers []Notifier) {
+    fmt.Printf("%s\n%s\n", alert.GetSubject(), alert.GetSummary())
+    for _,notifier := range notifiers {
+        if err := notifier.Notify(alert); err != nil {
+            fmt.Fprintf(os.Stderr, "Could not send alert for %s: %s\n",
+                alert.WatchName, err)
+        }
+    }
+}
+
+/**
+ * POSTs the alert as JSON. The payload has a top-level "text" field, so a
+ *     Slack incoming webhook URL works as-is.
+ */
+type WebhookNotifier struct {
+    URL string
+}
+
+func (n WebhookNotifier) Notify(alert Alert) error {
+
+    body, err := json.Marshal(NewAlertPayload(alert))
+    if err != nil {
+        return err
+    }
+
+    client := http.Client{ Timeout: time.Second * 30 }
+    res, err := client.Post(n.URL, JSON_TYPE, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    defer res.Body.Close()
+
+    if res.StatusCode < 200 || res.StatusCode >= 300 {
+        return fmt.Errorf("webhook returned %s", res.Status)
+    }
+    return nil
+
+}
+
+/**
+ * Emails the alert, with the option laid out the same way as the terminal
+ *     cards. Username may be left empty for servers that don't need auth.
+ */
+type SMTPNotifier struct {
+    Addr string // host:port
+    Username string
+    Password string
+    From string
+    To []string
+}
+
+func (n SMTPNotifier) Notify(alert Alert) error {
+
+    var auth smtp.Auth
+    if len(n.Username) > 0 {
+        host := strings.Split(n.Addr, ":")[0]
+        auth = smtp.PlainAuth("", n.Username, n.Password, host)
+    }
+    return smtp.SendMail(n.Addr, auth, n.From, n.To, n.BuildMessage(alert))
+
+}
+
+func (n SMTPNotifier) BuildMessage(alert Alert) []byte {
+
+    body := new(bytes.Buffer)
+    fmt.Fprintf(body, "%s\n\n", alert.Reason)
+    fmt.Fprintf(body, "Cost:       $%.2f\n", alert.Option.GetEffectivePrice())
+    fmt.Fprintf(body, "Outbound:   ")
+    PrintSlice(body, alert.Option.Slices[0])
+    fmt.Fprintf(body, "Inbound:    ")
+    PrintSlice(body, alert.Option.Slices[1])
+
+    msg := new(bytes.Buffer)
+    fmt.Fprintf(msg, "From: %s\r\n", n.From)
+    fmt.Fprintf(msg, "To: %s\r\n", strings.Join(n.To, ", "))
+    fmt.Fprintf(msg, "Subject: %s\r\n", alert.GetSubject())
+    fmt.Fprintf(msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+    fmt.Fprintf(msg, "MIME-Version: 1.0\r\n")
+    fmt.Fprintf(msg, "Content-Type: text/plain; charset=utf-8\r\n")
+    fmt.Fprintf(msg, "\r\n")
+    msg.WriteString(strings.Replace(StripColor(body.String()), "\n", "\r\n", -1))
+    return msg.Bytes()
+
+}
+
+/**
+ * Runs a local command with the alert payload as JSON on stdin, for hooking
+ *     up desktop notifications or anything else.
+ */
+type CommandNotifier struct {
+    Command []string
+}
+
+func (n CommandNotifier) Notify(alert Alert) error {
+
+    if len(n.Command) == 0 {
+        return fmt.Errorf("no command given")
+    }
+    body, err := json.Marshal(NewAlertPayload(alert))
+    if err != nil {
+        return err
+    }
+
+    cmd := exec.Command(n.Command[0], n.Command[1:]...)
+    cmd.Stdin = bytes.NewReader(body)
+    cmd.Stdout = os.Stderr
+    cmd.Stderr = os.Stderr
+    return cmd.Run()
+
+}
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// The card layout uses terminal colors, which don't belong in email
+func StripColor(text string) string {
+    return ansiEscape.ReplaceAllString(text, "")
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "io/ioutil"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func GetNotifierTestAlert() Alert {
+    option := GetBrowserTestOptions()[1]
+    option.BagFees = 50
+    option.EffectivePrice = 250
+    return Alert{
+        WatchName: "Boston",
+        Reason: "Price $250.00 is at or below target $275.00",
+        Option: option,
+        PreviousPrice: 320,
+        HasPreviousPrice: true,
+    }
+}
+
+func CheckAlertPayload(t *testing.T, data []byte) {
+    t.Helper()
+    var payload AlertPayload
+    if err := json.Unmarshal(data, &payload); err != nil {
+        t.Fatalf("%s: %s", err, data)
+    }
+    if payload.Watch != "Boston" || payload.Price != 250 ||
+        payload.PreviousPrice == nil || *payload.PreviousPrice != 320 {
+        t.Errorf("unexpected payload: %s", data)
+    }
+    if !strings.HasPrefix(payload.Text, "Fare alert for Boston: $250.00\n") {
+        t.Errorf("unexpected text: %q", payload.Text)
+    }
+}
+
+func TestWebhookNotifier(t *testing.T) {
+
+    var received []byte
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+        r *http.Request) {
+        if r.Method != http.MethodPost || r.Header.Get("Content-Type") != JSON_TYPE {
+            t.Errorf("got %s with content type %q", r.Method, r.Header.Get("Content-Type"))
+        }
+        received, _ = ioutil.ReadAll(r.Body)
+    }))
+    defer server.Close()
+
+    if err := (WebhookNotifier{ URL: server.URL }).Notify(GetNotifierTestAlert()); err != nil {
+        t.Fatal(err)
+    }
+    CheckAlertPayload(t, received)
+
+    failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+        r *http.Request) {
+        http.Error(w, "no", http.StatusForbidden)
+    }))
+    defer failing.Close()
+    if err := (WebhookNotifier{ URL: failing.URL }).Notify(GetNotifierTestAlert()); err == nil {
+        t.Error("a 403 from the webhook wasn't reported")
+    }
+
+}
+
+/**
+ * Just enough of an SMTP server to take one message, without STARTTLS or
+ *     AUTH. The message arrives on the channel once the client sends it.
+ */
+func StartFakeSMTPServer(t *testing.T) (addr string, messages chan string) {
+
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    messages = make(chan string, 1)
+    go func() {
+        defer listener.Close()
+        conn, err := listener.Accept()
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+
+        r := bufio.NewReader(conn)
+        reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+        reply("220 localhost ready")
+        for {
+            line, err := r.ReadString('\n')
+            if err != nil {
+                return
+            }
+            switch command := strings.ToUpper(strings.Fields(line + " ")[0]); command {
+            case "EHLO", "HELO", "MAIL", "RCPT":
+                reply("250 OK")
+            case "DATA":
+                reply("354 go ahead")
+                var msg []string
+                for {
+                    line, err := r.ReadString('\n')
+                    if err != nil || line == ".\r\n" {
+                        break
+                    }
+                    msg = append(msg, line)
+                }
+                messages <- strings.Join(msg, "")
+                reply("250 OK")
+            case "QUIT":
+                reply("221 bye")
+                return
+            default:
+                reply("502 not implemented")
+            }
+        }
+    }()
+    return listener.Addr().String(), messages
+
+}
+
+func TestSMTPNotifier(t *testing.T) {
+
+    addr, messages := StartFakeSMTPServer(t)
+    notifier := SMTPNotifier{
+        Addr: addr,
+        From: "flights@example.com",
+        To: []string{ "me@example.com", "you@example.com" },
+    }
+    if err := notifier.Notify(GetNotifierTestAlert()); err != nil {
+        t.Fatal(err)
+    }
+
+    msg := <-messages
+    for _,expected := range []string{
+        "To: me@example.com, you@example.com\r\n",
+        "Subject: Fare alert for Boston: $250.00\r\n",
+        "\r\n\r\nPrice $250.00 is at or below target $275.00\r\n",
+        "Cost:       $250.00\r\n",
+    } {
+        if !strings.Contains(msg, expected) {
+            t.Errorf("message is missing %q:\n%s", expected, msg)
+        }
+    }
+    if strings.Contains(msg, "\x1b[") {
+        t.Errorf("message has terminal colors:\n%q", msg)
+    }
+
+}
+
+func TestCommandNotifier(t *testing.T) {
+
+    out := filepath.Join(t.TempDir(), "payload.json")
+    notifier := CommandNotifier{ Command: []string{ "sh", "-c", "cat > \"$0\"", out } }
+    if err := notifier.Notify(GetNotifierTestAlert()); err != nil {
+        t.Fatal(err)
+    }
+    data, err := ioutil.ReadFile(out)
+    if err != nil {
+        t.Fatal(err)
+    }
+    CheckAlertPayload(t, data)
+
+    if err := (CommandNotifier{ Command: []string{ "false" } }).Notify(
+        GetNotifierTestAlert()); err == nil {
+        t.Error("a failing command wasn't reported")
+    }
+
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "sort"
+    "time"
+    "github.com/fatih/color"
+)
+
+// QPX pricing beyond the daily free allotment, in USD
+const QPX_COST_PER_QUERY = 0.035
+
+// Minimum spacing between requests, to stay inside the QPX rate limit
+const QPX_REQUEST_INTERVAL = time.Millisecond * 200
+
+// What to do when the cross product is bigger than the query budget
+const (
+    BUDGET_REFUSE     = "refuse"     // Don't send anything
+    BUDGET_SAMPLE     = "sample"     // Evenly spaced subset of the requests
+    BUDGET_PRIORITIZE = "prioritize" // Highest scoring subset of the requests
+)
+
+type QueryPlan struct {
+    NumRequests int
+    CachedRequests int
+    EstimatedCost float64
+    EstimatedTime time.Duration
+}
+
+/**
+ * Work out how many requests a search will make and what they will cost.
+ *
+ * Requests already in the cache are free and don't wait on the rate limiter.
+ */
+func PlanQueries(reqList []FlightsRequest, config AppConfig) (plan QueryPlan) {
+
+    plan.NumRequests = len(reqList)
+    for _,req := range reqList {
+        if IsCacheFresh(GetCacheFile(BuildQPXRequest(req)), config) {
+            plan.CachedRequests++
+        }
+    }
+
+    uncached := plan.NumRequests - plan.CachedRequests
+    plan.EstimatedCost = float64(uncached) * QPX_COST_PER_QUERY
+    plan.EstimatedTime = time.Duration(uncached) * QPX_REQUEST_INTERVAL
+    return
+
+}
+
+// Whether a request will go out to QPX, rather than the cache or a dry run
+func (config AppConfig) SendsToQPX(req FlightsRequest) bool {
+    return !config.DryRun && len(config.ReplayDir) == 0 &&
+        !IsCacheFresh(GetCacheFile(BuildQPXRequest(req)), config)
+}
+
+func (plan QueryPlan) Print() {
+    costFont := color.New(color.FgYellow, color.Bold)
+    fmt.Fprintf(os.Stderr, "Planned %d queries (%d cached), estimated ",
+        plan.NumRequests, plan.CachedRequests)
+    costFont.Fprintf(os.Stderr, "$%.2f", plan.EstimatedCost)
+    fmt.Fprintf(os.Stderr, " and %s\n", plan.EstimatedTime)
+}
+
+/**
+ * Cut the request list down to the query budget using the configured strategy.
+ *     Only requests that go out to QPX count against the budget, so cached
+ *     ones are always kept, ahead of those the strategy picks.
+ *
+ * Returns false if the budget is exceeded and the strategy is to refuse.
+ */
+func ApplyQueryBudget(reqList []FlightsRequest, input InputParams,
+    config AppConfig) ([]FlightsRequest, bool) {
+
+    if input.QueryBudget <= 0 {
+        return reqList, true
+    }
+    var sent, free []FlightsRequest
+    for _,req := range reqList {
+        if config.SendsToQPX(req) {
+            sent = append(sent, req)
+        } else {
+            free = append(free, req)
+        }
+    }
+    if len(sent) <= input.QueryBudget {
+        return reqList, true
+    }
+
+    switch input.BudgetStrategy {
+    case BUDGET_SAMPLE:
+        return append(free, SampleRequests(sent, input.QueryBudget)...), true
+    case BUDGET_PRIORITIZE:
+        return append(free, PrioritizeRequests(sent, input.QueryBudget)...), true
+    default:
+        return nil, false
+    }
+
+}
+
+/**
+ * Pick n requests spread evenly across the list, so every airport and date
+ *     combination is represented at roughly the same density.
+ */
+func SampleRequests(reqList []FlightsRequest, n int) (sampled []FlightsRequest) {
+    for i := 0; i < n; i++ {
+        sampled = append(sampled, reqList[i*len(reqList)/n])
+    }
+    return
+}
+
+/**
+ * Pick the n requests most likely to turn up cheap fares, keeping their
+ *     original order.
+ */
+func PrioritizeRequests(reqList []FlightsRequest, n int) (prioritized []FlightsRequest) {
+
+    indexes := make([]int, len(reqList))
+    for i := range indexes {
+        indexes[i] = i
+    }
+    sort.SliceStable(indexes, func(a, b int) bool {
+        return reqList[indexes[a]].getPriorityScore() > reqList[indexes[b]].getPriorityScore()
+    })
+
+    chosen := indexes[:n]
+    sort.Ints(chosen)
+    for _,i := range chosen {
+        prioritized = append(prioritized, reqList[i])
+    }
+    return
+
+}
+
+/**
+ * Rough heuristic: round trips through the same airports are usually priced
+ *     best, midweek and Saturday departures are cheaper, and holidays are not.
+ */
+func (req FlightsRequest) getPriorityScore() (score int) {
+
+    if req.Slices[0].Destination == req.Slices[1].Origin {
+        score++
+    }
+    if req.Slices[1].Destination == req.Slices[0].Origin {
+        score++
+    }
+
+    for _,slice := range req.Slices {
+        switch slice.Date.Weekday() {
+        case time.Tuesday, time.Wednesday, time.Saturday:
+            score++
+        }
+        if len(slice.DateTags) > 0 {
+            score--
+        }
+    }
+    return
+
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+    "io/ioutil"
+    "os"
+    "reflect"
+    "testing"
+)
+
+// One request per outbound day, Wed Mar 1 to Tue Mar 7, all back on Mon Mar 20
+func GetPlannerTestInput() InputParams {
+    return InputParams{
+        OriginAirport: "SFO",
+        DestAirport: "BOS",
+        Outbound: DirectionParams{ DateRange: [2]string{ "2017-03-01", "2017-03-07" } },
+        Inbound: DirectionParams{ Date: "2017-03-20" },
+        NumPassengers: 1,
+        QueryBudget: 3,
+    }
+}
+
+func GetOutboundDays(reqList []FlightsRequest) (days []int) {
+    for _,req := range reqList {
+        days = append(days, req.Slices[0].Date.Day())
+    }
+    return
+}
+
+func TestApplyQueryBudget(t *testing.T) {
+
+    input := GetPlannerTestInput()
+    reqList := BuildFlightRequest(input, nil)
+    for strategy,want := range map[string][]int{
+        BUDGET_SAMPLE: { 1, 3, 5 },
+        // Wednesday, Saturday and Tuesday departures
+        BUDGET_PRIORITIZE: { 1, 4, 7 },
+    } {
+        input.BudgetStrategy = strategy
+        kept, ok := ApplyQueryBudget(reqList, input, AppConfig{})
+        if !ok || !reflect.DeepEqual(GetOutboundDays(kept), want) {
+            t.Errorf("%s: got days %v, want %v", strategy, GetOutboundDays(kept), want)
+        }
+    }
+
+    input.BudgetStrategy = BUDGET_REFUSE
+    if kept, ok := ApplyQueryBudget(reqList, input, AppConfig{}); ok || kept != nil {
+        t.Errorf("refuse: got %d requests", len(kept))
+    }
+    input.QueryBudget = len(reqList)
+    if kept, ok := ApplyQueryBudget(reqList, input, AppConfig{}); !ok || len(kept) != 7 {
+        t.Errorf("got %d requests within the budget, want all 7", len(kept))
+    }
+
+}
+
+func TestApplyQueryBudgetSkipsCached(t *testing.T) {
+
+    wd, err := os.Getwd()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := os.Chdir(t.TempDir()); err != nil {
+        t.Fatal(err)
+    }
+    defer os.Chdir(wd)
+
+    input := GetPlannerTestInput()
+    input.BudgetStrategy = BUDGET_SAMPLE
+    reqList := BuildFlightRequest(input, nil)
+    os.Mkdir("cache", 0755)
+    for _,req := range reqList[1:3] {
+        if err := ioutil.WriteFile(GetCacheFile(BuildQPXRequest(req)), []byte("{}"),
+            0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    // Mar 2 and 3 are cached, leaving the budget for three of the other five
+    kept, ok := ApplyQueryBudget(reqList, input, AppConfig{ CacheOK: true })
+    if want := []int{ 2, 3, 1, 4, 6 }; !ok || !reflect.DeepEqual(GetOutboundDays(kept), want) {
+        t.Errorf("got days %v, want %v", GetOutboundDays(kept), want)
+    }
+
+    // Nothing is sent to QPX in a replay, so nothing counts
+    kept, ok = ApplyQueryBudget(reqList, input, AppConfig{ ReplayDir: REPLAY_DIR })
+    if !ok || len(kept) != 7 {
+        t.Errorf("got %d requests in a replay, want all 7", len(kept))
+    }
+
+}
@@ -3,9 +3,26 @@ package main
 import(
     "fmt"
     "bytes"
+    "io"
+    "os"
+    "strings"
     "github.com/fatih/color"
 )
 
+const (
+    OUTPUT_TEXT     = "text"     // Top options as cards
+    OUTPUT_TABLE    = "table"    // Top options, one line each
+    OUTPUT_MARKDOWN = "markdown" // Top options as a Markdown table
+    OUTPUT_HTML     = "html"     // Top options as a standalone HTML report
+    OUTPUT_MATRIX   = "matrix"   // Cheapest price per date pair as a grid
+    OUTPUT_JSON     = "json"     // Every option in one JSON document
+    OUTPUT_NDJSON   = "ndjson"   // One JSON option per line
+    OUTPUT_CSV      = "csv"      // One CSV row per option
+    OUTPUT_BROWSE   = "browse"   // Every option, sorted and filtered interactively
+)
+
+const CARD_WIDTH = 50
+
 func Min(x, y int) int {
     if x < y {
         return x
@@ -13,49 +30,143 @@ func Min(x, y int) int {
     return y
 }
 
-func PrintResults(optionsList []FlightsResultOption, attemptedRequests int, 
+/**
+ * The original layout: one boxed card per option, with a line per detail.
+ */
+type CardRenderer struct {
+    Limit int
+    ShowFares bool
+    ShowEmissions bool
+    Loyalty LoyaltyParams
+}
+
+func PrintResults(optionsList []FlightsResultOption, attemptedRequests int,
     successes int) {
 
-    const WIDTH = 50
+    summary := SearchSummary{
+        AttemptedRequests: attemptedRequests,
+        Successes: successes,
+    }
+    CardRenderer{}.Render(os.Stdout, summary, optionsList)
+
+}
+
+func (r CardRenderer) Render(w io.Writer, summary SearchSummary,
+    optionsList FlightsResultOptionList) error {
+
     costFont := color.New(color.FgYellow, color.Bold)
+    buf := new(bytes.Buffer)
+
+    // First print the summary of the operation
+    PrintSummary(buf, summary)
+
+    // Then print the actual flight details
+    for i := 0; i < Min(len(optionsList), GetResultLimit(r.Limit)); i++ {
+        option := optionsList[i]
+
+        fmt.Fprintln(buf, RepeatChar("=", CARD_WIDTH))
+        fmt.Fprintf(buf, "Cost:       ")
+        costFont.Fprintf(buf, "$%.2f", option.Price)
+        if r.Loyalty.EstimateMiles {
+            if miles, ok := r.Loyalty.EstimateMilesEarned(option); ok {
+                fmt.Fprintf(buf, "  (earns ~%.0f miles)", miles)
+            }
+        }
+        fmt.Fprintln(buf)
+        if option.BagFees > 0 {
+            fmt.Fprintf(buf, "With Bags:  ")
+            costFont.Fprintf(buf, "%s\n", DescribeBagFees(option))
+        }
+        if r.ShowFares {
+            PrintFare(buf, option)
+        }
+
+        fmt.Fprintln(buf, RepeatChar("-", CARD_WIDTH))
+        fmt.Fprintf(buf, "Outbound:   ")
+        PrintSlice(buf, option.Slices[0])
+        if r.ShowEmissions {
+            PrintSliceDistance(buf, option.Slices[0])
+        }
+
+        fmt.Fprintln(buf, RepeatChar("-", CARD_WIDTH))
+        fmt.Fprintf(buf, "Inbound:    ")
+        PrintSlice(buf, option.Slices[1])
+        if r.ShowEmissions {
+            PrintSliceDistance(buf, option.Slices[1])
+        }
+
+    }
+
+    _, err := buf.WriteTo(w)
+    return err
+
+}
+
+func PrintSummary(w io.Writer, summary SearchSummary) {
+
     successFont := color.New(color.FgGreen, color.Bold)
     failureFont := color.New(color.FgRed, color.Bold)
+    warningFont := color.New(color.FgYellow)
 
-    // First print the summary of the operation
-    if successes == attemptedRequests {
-        successFont.Printf("All %d queries returned successfully!\n", successes)
+    if summary.Successes == summary.AttemptedRequests {
+        successFont.Fprintf(w, "All %d queries returned successfully!\n",
+            summary.Successes)
     } else {
-        failureFont.Printf(
-            "Errors! Only %d/%d queries returned successfully.\n", successes, 
-            attemptedRequests)
+        failureFont.Fprintf(w,
+            "Errors! Only %d/%d queries returned successfully.\n",
+            summary.Successes, summary.AttemptedRequests)
+    }
+    for _,warning := range summary.Warnings {
+        warningFont.Fprintf(w, "Warning: %s\n", warning)
     }
 
-    // Then print the actual flight details
-    for i := 0; i < Min(len(optionsList), 10); i++ {
-        option := optionsList[i]
+}
 
-        fmt.Println(RepeatChar("=", WIDTH))
-        fmt.Printf("Cost:       ")
-        costFont.Printf("$%.2f\n", option.Price)
+func PrintFare(w io.Writer, option FlightsResultOption) {
 
-        fmt.Println(RepeatChar("-", WIDTH))
-        fmt.Printf("Outbound:   ")
-        PrintSlice(option.Slices[0])
+    fare := option.Fare
+    if !fare.HasPricing {
+        fmt.Fprintln(w, "Fare:       no breakdown available")
+        return
+    }
 
-        fmt.Println(RepeatChar("-", WIDTH))
-        fmt.Printf("Inbound:    ")
-        PrintSlice(option.Slices[1])
+    var taxes []string
+    for _,tax := range fare.TaxBreakdown {
+        taxes = append(taxes, fmt.Sprintf("%s $%.2f", tax.Code, tax.Amount))
+    }
+    refundable := "no"
+    if fare.Refundable {
+        refundable = "yes"
+    }
 
+    fmt.Fprintf(w, "Base Fare:  $%.2f\n", fare.BaseFare)
+    fmt.Fprintf(w, "Taxes:      $%.2f", fare.Taxes)
+    if len(taxes) > 0 {
+        fmt.Fprintf(w, " (%s)", strings.Join(taxes, ", "))
+    }
+    fmt.Fprintln(w)
+    fmt.Fprintf(w, "Fare Basis: %s\n", strings.Join(fare.FareBasis, ", "))
+    fmt.Fprintf(w, "Booking:    %s\n", strings.Join(option.GetBookingCodes(), ", "))
+    fmt.Fprintf(w, "Refundable: %s\n", refundable)
+    fmt.Fprintf(w, "Free Bags:  %d\n", fare.FreeBags)
+    if len(fare.FareCalculation) > 0 {
+        fmt.Fprintf(w, "Fare Calc:  %s\n", fare.FareCalculation)
     }
 
 }
 
-func PrintSlice(slice FlightsResultSlice) {
+func PrintSliceDistance(w io.Writer, slice FlightsResultSlice) {
+    fmt.Fprintf(w, "Distance:   ")
+    color.New(color.FgCyan).Fprintf(w, "%s\n", DescribeSliceDistance(slice))
+}
+
+func PrintSlice(w io.Writer, slice FlightsResultSlice) {
 
     const DATETIME_FMT = "Mon Jan 02 03:04 PM MST"
     flightMainFont    := color.New(color.FgCyan, color.Bold)
     flightDetailFont  := color.New(color.FgCyan)
     warningFont       := color.New(color.FgRed, color.Bold)
+    holidayFont       := color.New(color.FgMagenta, color.Bold)
 
     // For multi-segment slices, we display each airport route on its own line
     /*if len(slice.Segments) > 1 {
@@ -66,22 +177,121 @@ func PrintSlice(slice FlightsResultSlice) {
 
         // For multi-segment slices, line up the airport routes
         if segmentNum > 0 {
-            fmt.Printf(RepeatChar(" ", 12))
+            fmt.Fprint(w, RepeatChar(" ", 12))
+        }
+        flightMainFont.Fprintf(w, "%s -> %s", segment.Origin, segment.Destination)
+        if cities := DescribeCities(segment.Origin, segment.Destination); len(cities) > 0 {
+            flightDetailFont.Fprintf(w, " (%s)", cities)
+        }
+        fmt.Fprintln(w)
+
+        fmt.Fprintf(w, "Flight:     ")
+        flightDetailFont.Fprintf(w, "%s (%s)", segment.FlightNumber, segment.Airline)
+        if len(segment.OperatingCarrier) > 0 {
+            flightDetailFont.Fprintf(w, ", operated by %s", segment.OperatingCarrier)
+        }
+        fmt.Fprintln(w)
+        fmt.Fprintf(w, "Departure:  ")
+        flightDetailFont.Fprintf(w, "%s\n",
+            InAirportTime(segment.DepartureTime, segment.Origin).Format(DATETIME_FMT))
+        fmt.Fprintf(w, "Arrival:    ")
+        flightDetailFont.Fprintf(w, "%s\n",
+            InAirportTime(segment.ArrivalTime, segment.Destination).Format(DATETIME_FMT))
+
+        if stops := DescribeSegmentStops(segment); len(stops) > 0 {
+            fmt.Fprintf(w, "Stops:      ")
+            warningFont.Fprintf(w, "%s\n", stops)
+        } else if segment.NumLegs > 1 {
+            // Runs saved before legs were kept only have the count
+            warningFont.Fprintf(w, "Multiple Legs: %d\n", segment.NumLegs)
+        }
+    }
+
+    if len(slice.DateTags) > 0 {
+        fmt.Fprintf(w, "Holiday:    ")
+        holidayFont.Fprintf(w, "%s\n", strings.Join(slice.DateTags, ", "))
+    }
+
+}
+
+/**
+ * Where a multi-leg segment touches down on the way, with the time on the
+ *     ground, e.g. DEN (0h45m). Empty for a single leg.
+ */
+func DescribeSegmentStops(segment FlightsResultSegment) string {
+    var stops []string
+    for i := 1; i < len(segment.Legs); i++ {
+        ground := segment.Legs[i].DepartureTime.Sub(segment.Legs[i-1].ArrivalTime)
+        stops = append(stops, fmt.Sprintf("%s (%s)", segment.Legs[i].Origin,
+            FormatDuration(ground)))
+    }
+    return strings.Join(stops, ", ")
+}
+
+/**
+ * One line per itinerary: latest price, range, median, trend and a sparkline
+ *     of every recorded price.
+ */
+func PrintFareHistory(w io.Writer, histories []ItineraryFareHistory) {
+
+    costFont    := color.New(color.FgYellow, color.Bold)
+    upFont      := color.New(color.FgRed, color.Bold)
+    downFont    := color.New(color.FgGreen, color.Bold)
+    detailFont  := color.New(color.FgCyan)
+
+    for _,history := range histories {
+        min, max, median := history.GetMinMaxMedian()
+
+        fmt.Fprintln(w, history.Itinerary)
+        fmt.Fprintf(w, "    ")
+        costFont.Fprintf(w, "%9s", fmt.Sprintf("$%.2f", history.GetLatest().Price))
+        fmt.Fprintf(w, "  min $%.2f  max $%.2f  median $%.2f  ", min, max, median)
+
+        switch trend := history.GetTrend(); trend {
+        case TREND_UP:
+            upFont.Fprintf(w, "%-7s", trend)
+        case TREND_DOWN:
+            downFont.Fprintf(w, "%-7s", trend)
+        default:
+            fmt.Fprintf(w, "%-7s", trend)
         }
-        flightMainFont.Printf("%s -> %s\n", segment.Origin, segment.Destination)
+        fmt.Fprintf(w, "  ")
+        detailFont.Fprintf(w, "%s", Sparkline(history.GetPrices()))
+        fmt.Fprintf(w, " (%d runs)\n", len(history.Points))
+    }
+
+}
 
-        fmt.Printf("Flight:     ")
-        flightDetailFont.Printf("%s (%s)\n", segment.FlightNumber, segment.Airline)
-        fmt.Printf("Departure:  ")
-        flightDetailFont.Printf("%s\n", segment.DepartureTime.Format(DATETIME_FMT))
-        fmt.Printf("Arrival:    ")
-        flightDetailFont.Printf("%s\n", segment.ArrivalTime.Format(DATETIME_FMT))
+/**
+ * Values scaled between their own min and max, one block character each.
+ */
+func Sparkline(values []float64) string {
 
-        if segment.NumLegs > 1 {
-            warningFont.Printf("Multiple Legs: %d\n", segment.NumLegs)
+    blocks := []rune("▁▂▃▄▅▆▇█")
+    if len(values) == 0 {
+        return ""
+    }
+
+    min, max := values[0], values[0]
+    for _,v := range values {
+        if v < min {
+            min = v
+        }
+        if v > max {
+            max = v
         }
     }
 
+    var buffer bytes.Buffer
+    for _,v := range values {
+        level := 0
+        if max > min {
+            level = int((v - min) / (max - min) * float64(len(blocks)-1) + 0.5)
+        }
+        buffer.WriteRune(blocks[level])
+    }
+    return buffer.String()
+
 }
 
 func RepeatChar(char string, num int) string {
@@ -90,4 +300,4 @@ func RepeatChar(char string, num int) string {
         buffer.WriteString(char)
     }
     return buffer.String()
-}
\ No newline at end of file
+}
@@ -0,0 +1,28 @@
+package main
+
+const (
+    PROGRESS_PLANNED   = "planned"            // Total is set, nothing sent yet
+    PROGRESS_STARTED   = "request_started"
+    PROGRESS_SUCCEEDED = "request_succeeded"  // Result is set
+    PROGRESS_FAILED    = "request_failed"     // Result is set, with its Error
+)
+
+/**
+ * Something that happened while a batch of requests was running. Requests
+ *     finish in whatever order QPX answers them.
+ */
+type ProgressEvent struct {
+    Type string
+    Request FlightsRequest
+    Result FlightsResult
+    Total int
+}
+
+type ProgressFunc func(event ProgressEvent)
+
+// Progress is optional; the command line only needs the stderr counter
+func (config AppConfig) ReportProgress(event ProgressEvent) {
+    if config.Progress != nil {
+        config.Progress(event)
+    }
+}
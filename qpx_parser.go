@@ -12,6 +12,7 @@ import (
     "io/ioutil"
     "math"
     "github.com/mitchellh/hashstructure"
+    "github.com/StephensAndrewM/FlightFinder/refdata"
 )
 
 const QPX_URL = "https://www.googleapis.com/qpxExpress/v1/trips/search?key=" + API_KEY
@@ -20,11 +21,21 @@ const JSON_TYPE = "application/json"
 type AppConfig struct {
     DryRun bool
     CacheOK bool
+    CacheTTL time.Duration
+    HistoryFile string
+    Progress ProgressFunc
+
+    // Save every QPX exchange to RecordDir, or answer every request from the
+    //     recordings in ReplayDir without contacting QPX
+    RecordDir string
+    ReplayDir string
 }
 
 // QPX Request Items
 type FlightsRequest struct {
     NumPassengers int
+    CheckedBags int
+    CarryOnBags int
     Slices [2]FlightsRequestSlice
 }
 
@@ -34,33 +45,89 @@ type FlightsRequestSlice struct {
     Date time.Time
     TimeBounds [2]string
     MaxLegs int
+    DateTags []string
 }
 
 type FlightsResultOptionList []FlightsResultOption
 
 type FlightsResult struct {
+    Request FlightsRequest
     Options FlightsResultOptionList
     Success bool
+    Error string
+    Warnings []string // Why any options in the response were left out
 }
 
 type FlightsResultOption struct {
     Price float64
+    BagFees float64
+    EffectivePrice float64 // Price plus BagFees
     Slices [2]FlightsResultSlice
+    Fare FlightsResultFare
+}
+
+// What the price is made of, summed over every passenger
+type FlightsResultFare struct {
+    HasPricing bool // Responses cached before this was decoded don't have it
+    BaseFare float64
+    Taxes float64
+    TaxBreakdown []FlightsResultTax
+    FareCalculation string
+    FareBasis []string
+    Refundable bool
+    FreeBags int // Checked bags included on every segment
+}
+
+type FlightsResultTax struct {
+    Code string
+    Amount float64
 }
 
 type FlightsResultSlice struct {
     Duration time.Duration
     Segments []FlightsResultSegment
+    DateTags []string
+
+    // Great-circle miles; zero if an airport's location isn't known
+    Distance float64
+    DirectDistance float64 // From the first origin to the last destination
+    DetourRatio float64 // Distance over DirectDistance
+    CO2 float64 // Estimated kg per passenger
 }
 
 type FlightsResultSegment struct {
     Airline string
+    MarketingCarrier string
+    OperatingCarrier string // Only set for code-share flights
+    OperatingCarrierCode string // Empty if the operator isn't in the airline database
     FlightNumber string
     Origin string
     Destination string
     DepartureTime time.Time
     ArrivalTime time.Time
     NumLegs int
+    Legs []FlightsResultLeg
+    BookingCode string
+    Cabin string
+    Distance float64 // Great-circle miles over its legs
+    CO2 float64 // Estimated kg per passenger
+}
+
+// One takeoff and landing. A segment has several when its flight number
+//     makes intermediate stops.
+type FlightsResultLeg struct {
+    Origin string
+    Destination string
+    OriginTerminal string
+    DestinationTerminal string
+    DepartureTime time.Time
+    ArrivalTime time.Time
+    Duration time.Duration
+    Aircraft string
+    OnTimePerformance int // Percent, zero if unknown
+    Meal string
+    OperatingCarrier string // Only set when another airline flies the leg
+    Mileage int
 }
 
 
@@ -102,10 +169,13 @@ type QPXTripsResult struct {
 type QPXData struct {
     Airport []QPXAirport                    `json:"airport"`
     Carrier []QPXCarrier                    `json:"carrier"`
+    Aircraft []QPXAircraft                  `json:"aircraft"`
 }
 
 type QPXAirport struct {
+    Code string                 `json:"code"`
     City string                 `json:"city"`
+    Name string                 `json:"name"`
 }
 
 type QPXCarrier struct {
@@ -113,9 +183,52 @@ type QPXCarrier struct {
     Name string                 `json:"name"`
 }
 
+type QPXAircraft struct {
+    Code string                 `json:"code"`
+    Name string                 `json:"name"`
+}
+
 type QPXTripOption struct {
     SaleTotal string                    `json:"saleTotal"`
     Slice     []QPXSlice                    `json:"slice"`
+    Pricing   []QPXPricing                  `json:"pricing"`
+}
+
+// One per passenger type; amounts are for a single passenger
+type QPXPricing struct {
+    Fare []QPXFare                  `json:"fare"`
+    SegmentPricing []QPXSegmentPricing      `json:"segmentPricing"`
+    BaseFareTotal string            `json:"baseFareTotal"` // In the fare's own currency
+    SaleFareTotal string            `json:"saleFareTotal"` // Base fare in the sale currency
+    SaleTaxTotal string             `json:"saleTaxTotal"`
+    Tax []QPXTax                    `json:"tax"`
+    FareCalculation string          `json:"fareCalculation"`
+    Refundable bool                 `json:"refundable"`
+    Passengers QPXPassengerCounts   `json:"passengers"`
+}
+
+type QPXFare struct {
+    Carrier string                  `json:"carrier"`
+    Origin string                   `json:"origin"`
+    Destination string              `json:"destination"`
+    BasisCode string                `json:"basisCode"`
+}
+
+type QPXSegmentPricing struct {
+    SegmentID string                `json:"segmentId"`
+    FreeBaggageOption []QPXFreeBaggageAllowance     `json:"freeBaggageOption"`
+}
+
+type QPXFreeBaggageAllowance struct {
+    Pieces int                      `json:"pieces"`
+    Kilos int                       `json:"kilos"`
+    Pounds int                      `json:"pounds"`
+}
+
+type QPXTax struct {
+    Code string                     `json:"code"`
+    Country string                  `json:"country"`
+    SalePrice string                `json:"salePrice"`
 }
 
 type QPXSlice struct {
@@ -126,6 +239,8 @@ type QPXSlice struct {
 type QPXSegment struct {
     Flight QPXFlightDetail                  `json:"flight"`
     Leg    []QPXLeg                 `json:"leg"`
+    BookingCode string              `json:"bookingCode"`
+    Cabin string                    `json:"cabin"`
 }
 
 type QPXFlightDetail struct {
@@ -138,6 +253,14 @@ type QPXLeg struct {
     DepartureTime string                 `json:"departureTime"`
     Origin string                   `json:"origin"`
     Destination string                  `json:"destination"`
+    OriginTerminal string               `json:"originTerminal"`
+    DestinationTerminal string          `json:"destinationTerminal"`
+    Aircraft string                 `json:"aircraft"`
+    Duration int                    `json:"duration"`
+    OnTimePerformance int           `json:"onTimePerformance"`
+    Meal string                     `json:"meal"`
+    OperatingDisclosure string      `json:"operatingDisclosure"`
+    Mileage int                     `json:"mileage"`
 }
 
 type QPXResultError struct {
@@ -178,33 +301,33 @@ func BuildQPXRequest(req FlightsRequest) (qpxReq QPXRequest) {
 
 }
 
-func MakeQPXRequest(qpxReq QPXRequest, config AppConfig) (qpxRes QPXResult, success bool) {
+/**
+ * Send a request to QPX, or read its response from the cache or a recording.
+ *     When the request doesn't succeed, reason says why.
+ */
+func MakeQPXRequest(qpxReq QPXRequest, config AppConfig) (qpxRes QPXResult,
+    success bool, reason string) {
 
     // fmt.Printf("QPX Request: %+v\n", qpxReq)
 
     // Encode the request struct as a JSON bytestring, then convert to buffer
     reqEncoded, encodingError := json.Marshal(qpxReq)
     if encodingError != nil {
-        fmt.Printf("Error creating JSON for QPX request: %s\n", encodingError)
+        fmt.Fprintf(os.Stderr, "Error creating JSON for QPX request: %s\n", encodingError)
     }
     reqBuf := bytes.NewBuffer(reqEncoded)
 
     // fmt.Println(reqBuf.String())
 
-    // Create a hash of the request object (for cache purposes)
-    hash, hashError := hashstructure.Hash(qpxReq, nil)
-    if hashError != nil {
-        fmt.Printf("Error creating hash for QPX request: %s\n", hashError)
-    }
-
     if config.DryRun {
-        fmt.Println("Would have sent QPX Request: ")
-        fmt.Printf("%+v\n", reqBuf.String())
+        fmt.Fprintln(os.Stderr, "Would have sent QPX Request: ")
+        fmt.Fprintf(os.Stderr, "%+v\n", reqBuf.String())
         success = false
+        reason = "dry run"
         return
     }
 
-    cacheFile := "cache/qpx-"+strconv.FormatUint(hash, 10)
+    cacheFile := GetCacheFile(qpxReq)
 
     // Results of getting flights JSON
     resBuf := new(bytes.Buffer)
@@ -212,13 +335,27 @@ func MakeQPXRequest(qpxReq QPXRequest, config AppConfig) (qpxRes QPXResult, succ
     isCacheableResponse := false
 
     file, fileError := ioutil.ReadFile(cacheFile)
-    if fileError != nil || !config.CacheOK {
+    if len(config.ReplayDir) > 0 {
+
+        recorded, replayError := LoadRecording(config.ReplayDir, qpxReq, reqEncoded)
+        if replayError != nil {
+            fmt.Fprintf(os.Stderr, "Unmatched request in replay: %s\n%s\n",
+                replayError, reqEncoded)
+            success = false
+            reason = REPLAY_UNMATCHED + replayError.Error()
+            return
+        }
+        resBuf.Write(recorded)
+        jsonError = json.Unmarshal(recorded, &qpxRes)
+
+    } else if fileError != nil || !IsCacheFresh(cacheFile, config) {
 
         // fmt.Printf("Cache miss: %s\n", fileError)
         res, httpError := http.Post(QPX_URL, JSON_TYPE, reqBuf)
         if httpError != nil {
-            fmt.Printf("Error communicating with QPX. Err: %s\n", httpError)
+            fmt.Fprintf(os.Stderr, "Error communicating with QPX. Err: %s\n", httpError)
             success = false
+            reason = "error communicating with QPX: " + httpError.Error()
             return
         }
         
@@ -229,21 +366,32 @@ func MakeQPXRequest(qpxReq QPXRequest, config AppConfig) (qpxRes QPXResult, succ
     } else {
 
         // fmt.Printf("Cache hit: %s\n", cacheFile)
+        resBuf.Write(file)
         jsonError = json.Unmarshal(file, &qpxRes)
 
     }
 
+    if len(config.RecordDir) > 0 && jsonError == nil {
+        err := SaveRecording(config.RecordDir, qpxReq, reqEncoded, resBuf.Bytes())
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error recording QPX response: %s\n", err)
+        }
+    }
+
     
     // fmt.Printf("QPX Response: %+v\n", resBuf)
     
     if jsonError != nil {
-        fmt.Printf("Error interpreting QPX response. Err: %s\n", jsonError)
+        fmt.Fprintf(os.Stderr, "Error interpreting QPX response. Err: %s\n", jsonError)
         success = false
+        reason = "error interpreting QPX response: " + jsonError.Error()
         return
     }
 
     if len(qpxRes.Error.Errors) > 0 {
         success = false
+        reason = "QPX error: " + qpxRes.Error.Errors[0].Reason + ": " +
+            qpxRes.Error.Errors[0].Message
         return
     }
 
@@ -257,9 +405,37 @@ func MakeQPXRequest(qpxReq QPXRequest, config AppConfig) (qpxRes QPXResult, succ
 
 }
 
-func InterpretQPXResult(qpxRes QPXResult, success bool) (res FlightsResult) {
+/**
+ * Responses are cached in a file named by a hash of the request object.
+ */
+func GetCacheFile(qpxReq QPXRequest) (string) {
+    return "cache/qpx-" + GetRequestHash(qpxReq)
+}
+
+func GetRequestHash(qpxReq QPXRequest) (string) {
+    hash, hashError := hashstructure.Hash(qpxReq, nil)
+    if hashError != nil {
+        fmt.Fprintf(os.Stderr, "Error creating hash for QPX request: %s\n", hashError)
+    }
+    return strconv.FormatUint(hash, 10)
+}
+
+/**
+ * Whether a cached response may be used instead of asking QPX again.
+ *     A zero TTL means cached responses never expire.
+ */
+func IsCacheFresh(cacheFile string, config AppConfig) (bool) {
+    if !config.CacheOK {
+        return false
+    }
+    info, err := os.Stat(cacheFile)
+    if err != nil {
+        return false
+    }
+    return config.CacheTTL <= 0 || time.Since(info.ModTime()) < config.CacheTTL
+}
 
-    var err error
+func InterpretQPXResult(qpxRes QPXResult, success bool) (res FlightsResult) {
 
     if !success {
         res.Success = false
@@ -268,87 +444,320 @@ func InterpretQPXResult(qpxRes QPXResult, success bool) (res FlightsResult) {
 
     res.Success = true
 
+    // One malformed option shouldn't cost us the rest of the response
+    for i,qpxOption := range qpxRes.Trips.TripOption {
+        option, err := InterpretQPXOption(qpxOption, qpxRes.Trips.Data)
+        if err != nil {
+            res.Warnings = append(res.Warnings,
+                fmt.Sprintf("Skipped option %d: %s", i+1, err))
+            continue
+        }
+        res.Options = append(res.Options, option)
+    }
+    return
+}
+
+func InterpretQPXOption(qpxOption QPXTripOption, data QPXData) (
+    option FlightsResultOption, err error) {
+
+    if option.Price, err = GetSaleCurrencyValue(qpxOption.SaleTotal); err != nil {
+        return option, fmt.Errorf("price: %s", err)
+    }
+    if len(qpxOption.Slice) != 2 {
+        return option, fmt.Errorf("expected 2 slices, got %d", len(qpxOption.Slice))
+    }
+    for i := 0; i < 2; i++ {
+        option.Slices[i], err = InterpretQPXSlice(qpxOption.Slice[i], data)
+        if err != nil {
+            return option, fmt.Errorf("%s slice: %s", SLICE_DIRECTIONS[i], err)
+        }
+    }
+    if option.Fare, err = InterpretQPXPricing(qpxOption.Pricing, option.Price); err != nil {
+        return option, fmt.Errorf("pricing: %s", err)
+    }
+    return
+
+}
+
+func InterpretQPXSlice(qpxSlice QPXSlice, data QPXData) (
+    slice FlightsResultSlice, err error) {
+
+    if len(qpxSlice.Segment) == 0 {
+        return slice, fmt.Errorf("no segments")
+    }
+    slice.Duration = time.Duration(qpxSlice.Duration)*time.Minute
+    for i,qpxSegment := range qpxSlice.Segment {
+        segment, err := InterpretQPXSegment(qpxSegment, data)
+        if err != nil {
+            return slice, fmt.Errorf("segment %d: %s", i+1, err)
+        }
+        slice.Segments = append(slice.Segments, segment)
+    }
+    slice.ApplyDistances()
+    return
+
+}
+
+/**
+ * A segment spans all of its legs: it leaves from the first leg's origin and
+ *     arrives with the last leg.
+ */
+func InterpretQPXSegment(qpxSegment QPXSegment, data QPXData) (
+    segment FlightsResultSegment, err error) {
+
+    if len(qpxSegment.Leg) == 0 {
+        return segment, fmt.Errorf("no legs")
+    }
+    segment.Airline = CarrierCodeToName(qpxSegment.Flight.Carrier, data.Carrier)
+    segment.MarketingCarrier = qpxSegment.Flight.Carrier
+    segment.FlightNumber = qpxSegment.Flight.Carrier + " " + qpxSegment.Flight.Number
+    segment.BookingCode = qpxSegment.BookingCode
+    segment.Cabin = qpxSegment.Cabin
+    for i,qpxLeg := range qpxSegment.Leg {
+        leg, err := InterpretQPXLeg(qpxLeg, data)
+        if err != nil {
+            return segment, fmt.Errorf("leg %d: %s", i+1, err)
+        }
+        segment.Legs = append(segment.Legs, leg)
+    }
+    segment.NumLegs = len(segment.Legs)
+
+    first := segment.Legs[0]
+    last := segment.Legs[len(segment.Legs) - 1]
+    segment.Origin = first.Origin
+    segment.Destination = last.Destination
+    segment.DepartureTime = first.DepartureTime
+    segment.ArrivalTime = last.ArrivalTime
+
+    // QPX only names the operator of a code-share flight, in plain text
+    for _,leg := range segment.Legs {
+        if len(leg.OperatingCarrier) == 0 {
+            continue
+        }
+        segment.OperatingCarrier = leg.OperatingCarrier
+        if airline, ok := refdata.FindAirlineByName(leg.OperatingCarrier); ok {
+            segment.OperatingCarrierCode = airline.IATA
+            segment.OperatingCarrier = airline.Name
+        }
+        break
+    }
+    return
+
+}
+
+func InterpretQPXLeg(qpxLeg QPXLeg, data QPXData) (leg FlightsResultLeg, err error) {
+
     const DATETIME_FMT = "2006-01-02T15:04-07:00"
-    const DATETIMEOUT_FMT = "Mon Jan 02 03:04 PM MST"
-
-    for _,qpxOption := range qpxRes.Trips.TripOption {
-        var option FlightsResultOption
-        option.Price = GetCurrencyValue(qpxOption.SaleTotal)
-
-        var outboundSlice,inboundSlice FlightsResultSlice
-        outboundSlice.Duration = time.Duration(qpxOption.Slice[0].Duration)*time.Minute
-        inboundSlice.Duration = time.Duration(qpxOption.Slice[1].Duration)*time.Minute
-
-        for _,qpxSegment := range qpxOption.Slice[0].Segment {
-            var segment FlightsResultSegment
-            segment.Airline = CarrierCodeToName(qpxSegment.Flight.Carrier, qpxRes.Trips.Data.Carrier)
-            segment.FlightNumber = qpxSegment.Flight.Carrier + " " + qpxSegment.Flight.Number
-            segment.Origin = qpxSegment.Leg[0].Origin
-            segment.Destination = qpxSegment.Leg[len(qpxSegment.Leg) - 1].Destination
-            segment.DepartureTime, err = time.Parse(DATETIME_FMT, qpxSegment.Leg[0].DepartureTime)
+
+    if len(qpxLeg.Origin) == 0 || len(qpxLeg.Destination) == 0 {
+        return leg, fmt.Errorf("missing origin or destination")
+    }
+    leg.Origin = qpxLeg.Origin
+    leg.Destination = qpxLeg.Destination
+    leg.OriginTerminal = qpxLeg.OriginTerminal
+    leg.DestinationTerminal = qpxLeg.DestinationTerminal
+    leg.DepartureTime, err = time.Parse(DATETIME_FMT, qpxLeg.DepartureTime)
+    if err != nil {
+        return leg, fmt.Errorf("could not interpret departure date: %q", qpxLeg.DepartureTime)
+    }
+    leg.ArrivalTime, err = time.Parse(DATETIME_FMT, qpxLeg.ArrivalTime)
+    if err != nil {
+        return leg, fmt.Errorf("could not interpret arrival date: %q", qpxLeg.ArrivalTime)
+    }
+    leg.Duration = time.Duration(qpxLeg.Duration)*time.Minute
+    leg.Aircraft = AircraftCodeToName(qpxLeg.Aircraft, data.Aircraft)
+    leg.OnTimePerformance = qpxLeg.OnTimePerformance
+    leg.Meal = qpxLeg.Meal
+    leg.OperatingCarrier = strings.TrimPrefix(qpxLeg.OperatingDisclosure, "OPERATED BY ")
+    leg.Mileage = qpxLeg.Mileage
+    return
+
+}
+
+func CarrierCodeToName(code string, lookup []QPXCarrier) (string) {
+    for _,carrier := range lookup {
+        if code == carrier.Code {
+            return carrier.Name
+        }
+    }
+    if airline, ok := refdata.LookupAirline(code); ok {
+        return airline.Name
+    }
+    return "Unknown"
+}
+
+/**
+ * Combine the per-passenger-type pricing into totals for the whole booking.
+ *     Free bags are the fewest allowed on any segment, since that's what can
+ *     be carried the whole way without paying.
+ *
+ * Fares between other countries are filed in a foreign currency. The base
+ *     fare then comes from its sale currency equivalent, or failing that,
+ *     whatever of the price isn't taxes. Taxes not in the sale currency are
+ *     left out of the breakdown.
+ */
+func InterpretQPXPricing(pricingList []QPXPricing, price float64) (
+    fare FlightsResultFare, err error) {
+
+    taxIndexes := make(map[string]int)
+    fare.Refundable = len(pricingList) > 0
+    fare.FreeBags = -1
+    baseFareMissing := false
+
+    for _,pricing := range pricingList {
+        fare.HasPricing = true
+        passengers := float64(pricing.Passengers.AdultCount)
+        if passengers < 1 {
+            passengers = 1
+        }
+
+        if len(pricing.BaseFareTotal) > 0 {
+            baseFare, ok, err := GetSaleCurrencyAmount(pricing.BaseFareTotal)
             if err != nil {
-                fmt.Printf("Could not interpret departure date: %s\n", qpxSegment.Leg[0].DepartureTime)
+                return fare, err
             }
-            segment.ArrivalTime, err = time.Parse(DATETIME_FMT, qpxSegment.Leg[len(qpxSegment.Leg) - 1].ArrivalTime)
-            if err != nil {
-                fmt.Printf("Could not interpret arrival date: %s", qpxSegment.Leg[len(qpxSegment.Leg) - 1].ArrivalTime)
+            if !ok && len(pricing.SaleFareTotal) > 0 {
+                if baseFare, ok, err = GetSaleCurrencyAmount(pricing.SaleFareTotal); err != nil {
+                    return fare, err
+                }
+            }
+            if ok {
+                fare.BaseFare += baseFare * passengers
+            } else {
+                baseFareMissing = true
             }
-            segment.NumLegs = len(qpxSegment.Leg)
-            outboundSlice.Segments = append(outboundSlice.Segments, segment)
         }
-
-        for _,qpxSegment := range qpxOption.Slice[1].Segment {
-            var segment FlightsResultSegment
-            segment.Airline = CarrierCodeToName(qpxSegment.Flight.Carrier, qpxRes.Trips.Data.Carrier)
-            segment.FlightNumber = qpxSegment.Flight.Carrier + " " + qpxSegment.Flight.Number
-            segment.Origin = qpxSegment.Leg[0].Origin
-            segment.Destination = qpxSegment.Leg[len(qpxSegment.Leg) - 1].Destination
-            segment.DepartureTime, err = time.Parse(DATETIME_FMT, qpxSegment.Leg[0].DepartureTime)
+        if len(pricing.SaleTaxTotal) > 0 {
+            taxes, ok, err := GetSaleCurrencyAmount(pricing.SaleTaxTotal)
             if err != nil {
-                fmt.Printf("Could not interpret departure date: %s\n", qpxSegment.Leg[0].DepartureTime)
+                return fare, err
+            }
+            if ok {
+                fare.Taxes += taxes * passengers
+            }
+        }
+        for _,qpxTax := range pricing.Tax {
+            if len(qpxTax.SalePrice) == 0 {
+                continue
             }
-            segment.ArrivalTime, err = time.Parse(DATETIME_FMT, qpxSegment.Leg[len(qpxSegment.Leg) - 1].ArrivalTime)
+            amount, ok, err := GetSaleCurrencyAmount(qpxTax.SalePrice)
             if err != nil {
-                fmt.Printf("Could not interpret arrival date: %s", qpxSegment.Leg[len(qpxSegment.Leg) - 1].ArrivalTime)
+                return fare, err
             }
-            segment.NumLegs = len(qpxSegment.Leg)
-            inboundSlice.Segments = append(inboundSlice.Segments, segment)
+            if !ok {
+                continue
+            }
+            i, ok := taxIndexes[qpxTax.Code]
+            if !ok {
+                i = len(fare.TaxBreakdown)
+                taxIndexes[qpxTax.Code] = i
+                fare.TaxBreakdown = append(fare.TaxBreakdown,
+                    FlightsResultTax{ Code: qpxTax.Code })
+            }
+            fare.TaxBreakdown[i].Amount += amount * passengers
         }
 
-        option.Slices[0] = outboundSlice
-        option.Slices[1] = inboundSlice
+        if len(fare.FareCalculation) == 0 {
+            fare.FareCalculation = pricing.FareCalculation
+        }
+        for _,qpxFare := range pricing.Fare {
+            fare.FareBasis = AppendUnique(fare.FareBasis, qpxFare.BasisCode)
+        }
+        fare.Refundable = fare.Refundable && pricing.Refundable
 
-        res.Options = append(res.Options, option)
+        for _,segmentPricing := range pricing.SegmentPricing {
+            pieces := 0
+            for _,allowance := range segmentPricing.FreeBaggageOption {
+                pieces += allowance.Pieces
+            }
+            if fare.FreeBags < 0 || pieces < fare.FreeBags {
+                fare.FreeBags = pieces
+            }
+        }
+    }
+
+    if fare.FreeBags < 0 {
+        fare.FreeBags = 0
+    }
+    if baseFareMissing {
+        fare.BaseFare = math.Max(price - fare.Taxes, 0)
     }
     return
+
 }
 
-func CarrierCodeToName(code string, lookup []QPXCarrier) (string) {
-    for _,carrier := range lookup {
-        if code == carrier.Code {
-            return carrier.Name
+func AppendUnique(list []string, item string) []string {
+    if len(item) == 0 {
+        return list
+    }
+    for _,existing := range list {
+        if existing == item {
+            return list
         }
     }
-    return "Unknown"
+    return append(list, item)
+}
+
+// Falls back to the code itself, which is still more useful than nothing
+func AircraftCodeToName(code string, lookup []QPXAircraft) (string) {
+    for _,aircraft := range lookup {
+        if code == aircraft.Code {
+            return aircraft.Name
+        }
+    }
+    return code
 }
 
 func GetDurationFromString(minutes string) (time.Duration) {
     i, err := strconv.Atoi(minutes)
     if err != nil {
-        fmt.Println("Could not interpret duration: " + minutes)
+        fmt.Fprintln(os.Stderr, "Could not interpret duration: " + minutes)
         os.Exit(1)
     }
     return time.Duration(i)*time.Minute
 }
 
-// Expected Input Format: USD316.40
-func GetCurrencyValue(amountStr string) (float64) {
-    amountFl, err := strconv.ParseFloat(strings.Replace(amountStr, "USD", "", 1), 32)
+// Prices are compared and printed in dollars, which is what QPX sells in
+const SALE_CURRENCY = "USD"
+
+// Expected Input Format: USD316.40 or EUR12.00
+func GetCurrencyValue(amountStr string) (currency string, amount float64, err error) {
+    if len(amountStr) < 3 {
+        return "", 0, fmt.Errorf("could not interpret amount: %q", amountStr)
+    }
+    currency = amountStr[:3]
+    for _,c := range currency {
+        if c < 'A' || c > 'Z' {
+            return "", 0, fmt.Errorf("could not interpret amount: %q", amountStr)
+        }
+    }
+    amount, err = strconv.ParseFloat(amountStr[3:], 32)
+    if err != nil || math.IsNaN(amount) || math.IsInf(amount, 0) || amount < 0 {
+        return "", 0, fmt.Errorf("could not interpret amount: %q", amountStr)
+    }
+    return currency, amount, nil
+}
+
+// An amount that has to be in the sale currency, like the total price
+func GetSaleCurrencyValue(amountStr string) (float64, error) {
+    currency, amount, err := GetCurrencyValue(amountStr)
     if err != nil {
-        fmt.Println("Could not interpret float: " + amountStr)
-        os.Exit(1)
+        return 0, err
+    }
+    if currency != SALE_CURRENCY {
+        return 0, fmt.Errorf("amount is in %s, not %s: %q", currency, SALE_CURRENCY,
+            amountStr)
+    }
+    return amount, nil
+}
+
+// An amount that's only usable in the sale currency. Not ok otherwise.
+func GetSaleCurrencyAmount(amountStr string) (amount float64, ok bool, err error) {
+    currency, amount, err := GetCurrencyValue(amountStr)
+    if err != nil || currency != SALE_CURRENCY {
+        return 0, false, err
     }
-    return amountFl
+    return amount, true, nil
 }
 
 
@@ -371,7 +780,7 @@ func (o FlightsResultOption) getPreferredAirlineScore() (score int) {
 }
 
 func (o FlightsResultOption) getPrice() (price int) {
-    return int(math.Floor(o.Price/10)*10)
+    return int(math.Floor(o.GetEffectivePrice()/10)*10)
 }
 
 
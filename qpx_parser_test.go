@@ -0,0 +1,158 @@
+package main
+
+import (
+    "encoding/json"
+    "io/ioutil"
+    "math"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// A small response in the shape QPX sends, for when there's nothing cached
+const SEED_QPX_RESPONSE = `{"trips":{"data":{"carrier":[{"code":"UA","name":"United Airlines, Inc."}]},
+"tripOption":[{"saleTotal":"USD316.40","slice":[
+ {"duration":420,"segment":[{"flight":{"carrier":"UA","number":"100"},"cabin":"COACH","leg":[
+   {"origin":"SFO","destination":"DEN","departureTime":"2017-03-29T08:00-07:00","arrivalTime":"2017-03-29T11:30-06:00","duration":150},
+   {"origin":"DEN","destination":"BOS","departureTime":"2017-03-29T12:15-06:00","arrivalTime":"2017-03-29T18:00-04:00","duration":225,"operatingDisclosure":"OPERATED BY SKYWEST DBA UNITED EXPRESS"}]}]},
+ {"duration":360,"segment":[{"flight":{"carrier":"UA","number":"200"},"leg":[
+   {"origin":"BOS","destination":"SFO","departureTime":"2017-04-02T08:00-04:00","arrivalTime":"2017-04-02T11:30-07:00","duration":390}]}]}],
+"pricing":[{"baseFareTotal":"USD246.50","saleTaxTotal":"USD69.90","passengers":{"adultCount":1},
+ "segmentPricing":[{"freeBaggageOption":[{"pieces":1}]}]}]}]}}`
+
+func TestInterpretQPXResultSkipsInvalidOptions(t *testing.T) {
+
+    var qpxRes QPXResult
+    if err := json.Unmarshal([]byte(SEED_QPX_RESPONSE), &qpxRes); err != nil {
+        t.Fatal(err)
+    }
+    valid := qpxRes.Trips.TripOption[0]
+
+    noSlices := valid
+    noSlices.Slice = nil
+    badPrice := valid
+    badPrice.SaleTotal = "USDabc"
+    noLegs := valid
+    noLegs.Slice = append([]QPXSlice{}, valid.Slice...)
+    noLegs.Slice[1].Segment = []QPXSegment{{ Flight: valid.Slice[1].Segment[0].Flight }}
+    qpxRes.Trips.TripOption = []QPXTripOption{ noSlices, valid, badPrice, noLegs }
+
+    res := InterpretQPXResult(qpxRes, true)
+    if len(res.Options) != 1 {
+        t.Fatalf("got %d options, want only the valid one", len(res.Options))
+    }
+    if len(res.Warnings) != 3 {
+        t.Fatalf("got warnings %q, want one per skipped option", res.Warnings)
+    }
+    for i,prefix := range []string{ "Skipped option 1:", "Skipped option 3:",
+        "Skipped option 4: inbound slice: segment 1: no legs" } {
+        if !strings.HasPrefix(res.Warnings[i], prefix) {
+            t.Errorf("warning %d is %q, want it to start with %q", i, res.Warnings[i], prefix)
+        }
+    }
+
+}
+
+func TestGetCurrencyValue(t *testing.T) {
+    for _,good := range []struct {
+        amountStr, currency string
+        amount float64
+    }{
+        { "USD316.40", "USD", 316.40 },
+        { "EUR12.00", "EUR", 12.00 },
+    } {
+        currency, amount, err := GetCurrencyValue(good.amountStr)
+        if err != nil || currency != good.currency || math.Abs(amount - good.amount) > 0.01 {
+            t.Errorf("%q: got %s %v, %v", good.amountStr, currency, amount, err)
+        }
+    }
+    for _,bad := range []string{ "", "USD", "316.40", "usd1", "USDNaN", "USD-5" } {
+        if _, _, err := GetCurrencyValue(bad); err == nil {
+            t.Errorf("%q was accepted", bad)
+        }
+    }
+    if _, err := GetSaleCurrencyValue("EUR12.00"); err == nil {
+        t.Error("a price in euros was accepted")
+    }
+}
+
+// Only the sale total has to be in dollars
+func TestInterpretQPXPricingForeignFare(t *testing.T) {
+
+    pricing := []QPXPricing{{
+        BaseFareTotal: "EUR200.00",
+        SaleTaxTotal: "USD70.00",
+        Tax: []QPXTax{{ Code: "US", SalePrice: "USD40.00" }, { Code: "FR", SalePrice: "EUR25.00" }},
+        Passengers: QPXPassengerCounts{ AdultCount: 2 },
+    }}
+    fare, err := InterpretQPXPricing(pricing, 620.00)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if fare.BaseFare != 480.00 || fare.Taxes != 140.00 {
+        t.Errorf("got base fare %v and taxes %v, want 480 and 140", fare.BaseFare, fare.Taxes)
+    }
+    if len(fare.TaxBreakdown) != 1 || fare.TaxBreakdown[0].Amount != 80.00 {
+        t.Errorf("got tax breakdown %+v, want only the US tax", fare.TaxBreakdown)
+    }
+
+    pricing[0].SaleFareTotal = "USD225.00"
+    if fare, err = InterpretQPXPricing(pricing, 620.00); err != nil || fare.BaseFare != 450.00 {
+        t.Errorf("got base fare %v, %v, want the sale fare of 450", fare.BaseFare, err)
+    }
+
+}
+
+/**
+ * Whatever the response holds, parsing shouldn't panic and every option that
+ *     survives should be safe to rank and print. Seeded from the responses
+ *     saved in cache/ by earlier searches.
+ */
+func FuzzInterpretQPXResult(f *testing.F) {
+
+    f.Add([]byte(SEED_QPX_RESPONSE))
+    cached, _ := filepath.Glob("cache/qpx-*")
+    for _,path := range cached {
+        if data, err := ioutil.ReadFile(path); err == nil {
+            f.Add(data)
+        }
+    }
+
+    f.Fuzz(func(t *testing.T, data []byte) {
+        var qpxRes QPXResult
+        if err := json.Unmarshal(data, &qpxRes); err != nil {
+            return
+        }
+        res := InterpretQPXResult(qpxRes, true)
+        if len(res.Options) + len(res.Warnings) != len(qpxRes.Trips.TripOption) {
+            t.Fatalf("%d options and %d warnings from %d trip options",
+                len(res.Options), len(res.Warnings), len(qpxRes.Trips.TripOption))
+        }
+        for _,option := range res.Options {
+            if math.IsNaN(option.Price) || option.Price < 0 {
+                t.Fatalf("bad price %v", option.Price)
+            }
+            for _,slice := range option.Slices {
+                if len(slice.Segments) == 0 {
+                    t.Fatal("slice without segments")
+                }
+                for _,segment := range slice.Segments {
+                    if len(segment.Legs) == 0 {
+                        t.Fatal("segment without legs")
+                    }
+                }
+            }
+        }
+
+        res.ApplyBagFees(FlightsRequest{ NumPassengers: 1, CheckedBags: 1 })
+        options := RankingParams{ PreferFlexible: true }.Rank(res.Options)
+        summary := SearchSummary{ AttemptedRequests: 1, Successes: 1, Warnings: res.Warnings }
+        for _,renderer := range []Renderer{ CardRenderer{ ShowFares: true, ShowEmissions: true },
+            TableRenderer{}, CSVRenderer{}, JSONRenderer{} } {
+            if err := renderer.Render(ioutil.Discard, summary, options); err != nil {
+                t.Fatal(err)
+            }
+        }
+    })
+
+}
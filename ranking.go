@@ -0,0 +1,135 @@
+package main
+
+import (
+    "sort"
+)
+
+/**
+ * How to narrow down and order the options from a search. Leaving it empty
+ *     gives the original ranking: cheapest first, in $10 bands.
+ *
+ * Options without pricing detail (from responses cached before it was kept)
+ *     never pass the fare filters.
+ */
+type RankingParams struct {
+    RequireRefundable bool
+    MinFreeBags int
+
+    // Within a price band, put refundable fares and more free bags first
+    PreferFlexible bool
+
+    // Carrier codes (IATA or ICAO) or alliance names. Preferred airlines replace the built-in JetBlue
+    //     preference when breaking ties; any segment on a blocked airline
+    //     drops the whole option.
+    PreferredAirlines []string
+    BlockedAirlines []string
+
+    // Check the lists against the airline flying each segment rather than
+    //     the one selling it
+    ByOperatingCarrier bool
+
+    // Within a price band, put options that earn on these programs first
+    Loyalty LoyaltyParams
+
+    // Drop options flying more than this many times the direct distance in
+    //     either direction, e.g. 1.5. Options that couldn't be measured pass.
+    MaxDetourRatio float64
+
+    // Within a price band, put options with lower estimated emissions first
+    PreferLowEmissions bool
+}
+
+type RankedOptions struct {
+    FlightsResultOptionList
+    Ranking RankingParams
+}
+
+func (ranking RankingParams) Allows(option FlightsResultOption) bool {
+    if ranking.RequireRefundable && !option.Fare.Refundable {
+        return false
+    }
+    if ranking.MinFreeBags > 0 &&
+        (!option.Fare.HasPricing || option.Fare.FreeBags < ranking.MinFreeBags) {
+        return false
+    }
+    if ranking.MaxDetourRatio > 0 && option.GetDetourRatio() > ranking.MaxDetourRatio {
+        return false
+    }
+    for _,slice := range option.Slices {
+        for _,segment := range slice.Segments {
+            if AirlineListMatches(ranking.BlockedAirlines, ranking.GetCarrierCode(segment)) {
+                return false
+            }
+        }
+    }
+    return true
+}
+
+func (ranking RankingParams) GetCarrierCode(segment FlightsResultSegment) string {
+    if ranking.ByOperatingCarrier {
+        return segment.GetOperatingCarrierCode()
+    }
+    return segment.GetCarrierCode()
+}
+
+// Number of segments on a preferred airline
+func (ranking RankingParams) GetPreferredAirlineScore(option FlightsResultOption) (
+    score int) {
+
+    for _,slice := range option.Slices {
+        for _,segment := range slice.Segments {
+            if AirlineListMatches(ranking.PreferredAirlines, ranking.GetCarrierCode(segment)) {
+                score++
+            }
+        }
+    }
+    return
+
+}
+
+/**
+ * Drop the options the ranking doesn't allow, then sort the rest in place.
+ */
+func (ranking RankingParams) Rank(optionsList FlightsResultOptionList) (
+    FlightsResultOptionList) {
+
+    var allowed FlightsResultOptionList
+    for _,option := range optionsList {
+        if ranking.Allows(option) {
+            allowed = append(allowed, option)
+        }
+    }
+    sort.Sort(RankedOptions{ allowed, ranking })
+    return allowed
+
+}
+
+func (options RankedOptions) Less(i, j int) bool {
+    a, b := options.FlightsResultOptionList[i], options.FlightsResultOptionList[j]
+    ranking := options.Ranking
+    if a.getPrice() == b.getPrice() {
+        if ranking.PreferFlexible && a.Fare.Refundable != b.Fare.Refundable {
+            return a.Fare.Refundable
+        }
+        if ranking.PreferFlexible && a.Fare.FreeBags != b.Fare.FreeBags {
+            return a.Fare.FreeBags > b.Fare.FreeBags
+        }
+        if !ranking.Loyalty.IsEmpty() {
+            unearnedA := ranking.Loyalty.GetUnearnedSegments(a)
+            unearnedB := ranking.Loyalty.GetUnearnedSegments(b)
+            if unearnedA != unearnedB {
+                return unearnedA < unearnedB
+            }
+        }
+        if ranking.PreferLowEmissions && a.GetCO2() != b.GetCO2() &&
+            a.GetCO2() > 0 && b.GetCO2() > 0 {
+            return a.GetCO2() < b.GetCO2()
+        }
+        if len(ranking.PreferredAirlines) > 0 &&
+            a.getTripLength() == b.getTripLength() {
+            return ranking.GetPreferredAirlineScore(a) >
+                ranking.GetPreferredAirlineScore(b)
+        }
+    }
+    return options.FlightsResultOptionList.Less(i, j)
+}
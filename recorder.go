@@ -0,0 +1,89 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+/**
+ * A QPX request and the response it got, saved so a search can be run again
+ *     later without QPX. Both are kept as the JSON that went over the wire.
+ */
+type QPXRecording struct {
+    Request json.RawMessage     `json:"request"`
+    Response json.RawMessage    `json:"response"`
+}
+
+/**
+ * Recordings are named by the same hash as the cache, but are kept until
+ *     deleted and hold the request alongside the response.
+ */
+func GetRecordingFile(dir string, qpxReq QPXRequest) (string) {
+    return filepath.Join(dir, "qpx-" + GetRequestHash(qpxReq) + ".json")
+}
+
+func SaveRecording(dir string, qpxReq QPXRequest, reqEncoded []byte,
+    resEncoded []byte) error {
+
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return err
+    }
+    recording := QPXRecording{ Request: reqEncoded, Response: resEncoded }
+    data, err := json.MarshalIndent(recording, "", "  ")
+    if err != nil {
+        return err
+    }
+    return ioutil.WriteFile(GetRecordingFile(dir, qpxReq), append(data, '\n'), 0644)
+
+}
+
+// Starts the reason a request fails with when it has no usable recording
+const REPLAY_UNMATCHED = "replay: "
+
+/**
+ * Find the first request a replay couldn't answer. Recorded QPX errors are
+ *     answers like any other, but a request that wasn't recorded (or was
+ *     recorded differently) means the replay doesn't match what was searched.
+ */
+func CheckReplayResults(resList []FlightsResult) error {
+    for _,res := range resList {
+        if !res.Success && strings.HasPrefix(res.Error, REPLAY_UNMATCHED) {
+            return fmt.Errorf("%s: %s", DescribeRequest(res.Request), res.Error)
+        }
+    }
+    return nil
+}
+
+/**
+ * The recorded response to exactly this request. It's an error for there to
+ *     be none, so replays never quietly fall back to QPX.
+ */
+func LoadRecording(dir string, qpxReq QPXRequest, reqEncoded []byte) (
+    resEncoded []byte, err error) {
+
+    file := GetRecordingFile(dir, qpxReq)
+    data, err := ioutil.ReadFile(file)
+    if os.IsNotExist(err) {
+        return nil, fmt.Errorf("no recording of this request in %s", dir)
+    } else if err != nil {
+        return nil, err
+    }
+
+    var recording QPXRecording
+    if err := json.Unmarshal(data, &recording); err != nil {
+        return nil, fmt.Errorf("%s: %s", file, err)
+    }
+    recorded, wanted := new(bytes.Buffer), new(bytes.Buffer)
+    json.Compact(recorded, recording.Request)
+    json.Compact(wanted, reqEncoded)
+    if !bytes.Equal(recorded.Bytes(), wanted.Bytes()) {
+        return nil, fmt.Errorf("%s was recorded for a different request", file)
+    }
+    return recording.Response, nil
+
+}
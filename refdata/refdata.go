@@ -0,0 +1,250 @@
+/**
+ * Reference data about airports and airlines that doesn't depend on any
+ *     particular QPX response. The datasets are embedded so lookups work
+ *     offline, and either can be replaced with a newer copy from disk.
+ */
+package refdata
+
+import (
+    "bytes"
+    _ "embed"
+    "encoding/csv"
+    "fmt"
+    "io"
+    "math"
+    "os"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+    _ "time/tzdata" // Airport time zones work without the system's zoneinfo
+)
+
+type Airport struct {
+    Code string
+    Name string
+    City string
+    Country string // ISO 3166 code
+    Latitude float64
+    Longitude float64
+    TimeZone string // IANA name, e.g. America/New_York
+}
+
+type Airline struct {
+    IATA string
+    ICAO string
+    Name string
+    Alliance string // Empty if the airline isn't in one
+}
+
+// Columns: code,name,city,country,latitude,longitude,timezone
+//go:embed airports.csv
+var airportsCSV []byte
+
+// Columns: iata,icao,name,alliance
+//go:embed airlines.csv
+var airlinesCSV []byte
+
+var lock sync.RWMutex
+var airports map[string]Airport
+var airlines map[string]Airline
+var loadOnce sync.Once
+
+func load() {
+    loadOnce.Do(func() {
+        var err error
+        if airports, err = ParseAirports(bytes.NewReader(airportsCSV)); err != nil {
+            panic(fmt.Sprintf("embedded airport data: %s", err))
+        }
+        if airlines, err = ParseAirlines(bytes.NewReader(airlinesCSV)); err != nil {
+            panic(fmt.Sprintf("embedded airline data: %s", err))
+        }
+    })
+}
+
+/**
+ * Replace the airport data with a CSV file in the same format as the
+ *     embedded one. The current data is kept if the file can't be read.
+ */
+func LoadAirportsFile(path string) error {
+    load()
+    f, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    parsed, err := ParseAirports(f)
+    if err != nil {
+        return fmt.Errorf("%s: %s", path, err)
+    }
+    lock.Lock()
+    airports = parsed
+    lock.Unlock()
+    return nil
+}
+
+/**
+ * Replace the airline data with a CSV file in the same format as the
+ *     embedded one. The current data is kept if the file can't be read.
+ */
+func LoadAirlinesFile(path string) error {
+    load()
+    f, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    parsed, err := ParseAirlines(f)
+    if err != nil {
+        return fmt.Errorf("%s: %s", path, err)
+    }
+    lock.Lock()
+    airlines = parsed
+    lock.Unlock()
+    return nil
+}
+
+func ParseAirports(r io.Reader) (map[string]Airport, error) {
+    rows, err := readRows(r, 7)
+    if err != nil {
+        return nil, err
+    }
+    parsed := make(map[string]Airport)
+    for i,row := range rows {
+        lat, latErr := strconv.ParseFloat(row[4], 64)
+        long, longErr := strconv.ParseFloat(row[5], 64)
+        if latErr != nil || longErr != nil {
+            return nil, fmt.Errorf("line %d: bad coordinates for %s", i+2, row[0])
+        }
+        code := strings.ToUpper(row[0])
+        if _, ok := parsed[code]; ok {
+            return nil, fmt.Errorf("line %d: %s is listed twice", i+2, code)
+        }
+        parsed[code] = Airport{ Code: code, Name: row[1], City: row[2],
+            Country: row[3], Latitude: lat, Longitude: long, TimeZone: row[6] }
+    }
+    return parsed, nil
+}
+
+func ParseAirlines(r io.Reader) (map[string]Airline, error) {
+    rows, err := readRows(r, 4)
+    if err != nil {
+        return nil, err
+    }
+    parsed := make(map[string]Airline)
+    for i,row := range rows {
+        code := strings.ToUpper(row[0])
+        if _, ok := parsed[code]; ok {
+            return nil, fmt.Errorf("line %d: %s is listed twice", i+2, code)
+        }
+        parsed[code] = Airline{ IATA: code, ICAO: strings.ToUpper(row[1]),
+            Name: row[2], Alliance: row[3] }
+    }
+    return parsed, nil
+}
+
+// Rows after the header, each with exactly the given number of columns
+func readRows(r io.Reader, columns int) ([][]string, error) {
+    reader := csv.NewReader(r)
+    reader.FieldsPerRecord = columns
+    rows, err := reader.ReadAll()
+    if err != nil {
+        return nil, err
+    }
+    if len(rows) < 2 {
+        return nil, fmt.Errorf("no data")
+    }
+    return rows[1:], nil
+}
+
+func LookupAirport(code string) (airport Airport, ok bool) {
+    load()
+    lock.RLock()
+    defer lock.RUnlock()
+    airport, ok = airports[strings.ToUpper(code)]
+    return
+}
+
+// Accepts either the IATA or the ICAO code
+func LookupAirline(code string) (airline Airline, ok bool) {
+    load()
+    lock.RLock()
+    defer lock.RUnlock()
+    code = strings.ToUpper(code)
+    if airline, ok = airlines[code]; ok {
+        return
+    }
+    for _,candidate := range airlines {
+        if len(candidate.ICAO) > 0 && candidate.ICAO == code {
+            return candidate, true
+        }
+    }
+    return Airline{}, false
+}
+
+var doingBusinessAs = regexp.MustCompile(` (DBA|AS) `)
+
+/**
+ * Find an airline from how QPX names it in an operating disclosure, e.g.
+ *     "SKYWEST DBA UNITED EXPRESS" is SkyWest, OO.
+ */
+func FindAirlineByName(name string) (Airline, bool) {
+    load()
+    wanted := NormalizeAirlineName(doingBusinessAs.Split(name, 2)[0])
+    if len(wanted) == 0 {
+        return Airline{}, false
+    }
+    lock.RLock()
+    defer lock.RUnlock()
+    for _,candidate := range airlines {
+        if NormalizeAirlineName(candidate.Name) == wanted {
+            return candidate, true
+        }
+    }
+    return Airline{}, false
+}
+
+var airlineNameNoise = regexp.MustCompile(`\b(AIRLINES|AIRLINE|AIRWAYS|AIR LINES|INC|LLC|CO|LTD)\b|[^A-Z0-9 ]`)
+
+// Uppercase without punctuation or the words that vary between listings
+func NormalizeAirlineName(name string) string {
+    name = airlineNameNoise.ReplaceAllString(strings.ToUpper(name), "")
+    return strings.Join(strings.Fields(name), " ")
+}
+
+// The local time zone. Not ok if the data names one that doesn't exist.
+func (airport Airport) GetLocation() (loc *time.Location, ok bool) {
+    loc, err := time.LoadLocation(airport.TimeZone)
+    if err != nil || len(airport.TimeZone) == 0 {
+        return nil, false
+    }
+    return loc, true
+}
+
+const EARTH_RADIUS_MILES = 3958.8
+
+/**
+ * Great-circle distance in statute miles, using the haversine formula.
+ */
+func Distance(from Airport, to Airport) float64 {
+    toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+    lat1, lat2 := toRadians(from.Latitude), toRadians(to.Latitude)
+    dLat := lat2 - lat1
+    dLong := toRadians(to.Longitude - from.Longitude)
+    h := math.Pow(math.Sin(dLat/2), 2) +
+        math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLong/2), 2)
+    return 2 * EARTH_RADIUS_MILES * math.Asin(math.Sqrt(h))
+}
+
+/**
+ * Distance between two airports by code. Not ok if either is unknown.
+ */
+func DistanceBetween(fromCode string, toCode string) (miles float64, ok bool) {
+    from, fromOk := LookupAirport(fromCode)
+    to, toOk := LookupAirport(toCode)
+    if !fromOk || !toOk {
+        return 0, false
+    }
+    return Distance(from, to), true
+}
@@ -0,0 +1,53 @@
+package refdata
+
+import (
+    "strings"
+    "testing"
+)
+
+// Every embedded airport should be usable for distances and local times
+func TestEmbeddedAirports(t *testing.T) {
+    load()
+    for code,airport := range airports {
+        if len(code) != 3 || len(airport.City) == 0 {
+            t.Errorf("%s: incomplete entry %+v", code, airport)
+        }
+        if _, ok := airport.GetLocation(); !ok {
+            t.Errorf("%s: unknown time zone %q", code, airport.TimeZone)
+        }
+    }
+}
+
+/**
+ * The regional and code-share operators are the reason the airline data
+ *     exists, so check that they can still be found by code and by the name
+ *     QPX gives them.
+ */
+func TestEmbeddedAirlines(t *testing.T) {
+
+    for _,code := range []string{ "2W", "9E", "OO", "YX", "ZW", "G7", "C5", "QX" } {
+        if _, ok := LookupAirline(code); !ok {
+            t.Errorf("%s is missing", code)
+        }
+    }
+    if airline, ok := LookupAirline("skw"); !ok || airline.IATA != "OO" {
+        t.Errorf("looking up SkyWest by ICAO code got %+v", airline)
+    }
+    for disclosure,code := range map[string]string{
+        "SKYWEST DBA UNITED EXPRESS": "OO",
+        "REPUBLIC AIRWAYS AS AMERICAN EAGLE": "YX",
+        "WELCOME AIR": "2W",
+    } {
+        if airline, ok := FindAirlineByName(disclosure); !ok || airline.IATA != code {
+            t.Errorf("%q: got %+v, want %s", disclosure, airline, code)
+        }
+    }
+
+}
+
+func TestParseAirlinesRejectsDuplicates(t *testing.T) {
+    data := "iata,icao,name,alliance\nUA,UAL,United Airlines,\nua,UAL,United,\n"
+    if _, err := ParseAirlines(strings.NewReader(data)); err == nil {
+        t.Error("a code listed twice was accepted")
+    }
+}
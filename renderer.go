@@ -0,0 +1,388 @@
+package main
+
+import (
+    "bytes"
+    "fmt"
+    "html/template"
+    "io"
+    "strings"
+    "time"
+    "github.com/fatih/color"
+)
+
+const DEFAULT_RESULT_LIMIT = 10
+
+type SearchSummary struct {
+    AttemptedRequests int
+    Successes int
+    Warnings []string // About parts of responses that had to be left out
+}
+
+/**
+ * Writes the outcome of a search. Options are expected to be ranked already;
+ *     renderers that show a limited number take them from the top.
+ */
+type Renderer interface {
+    Render(w io.Writer, summary SearchSummary, optionsList FlightsResultOptionList) error
+}
+
+/**
+ * Look up the renderer for the input's output format. The text format, and
+ *     no format at all, get the cards.
+ */
+func GetRenderer(input InputParams) (Renderer) {
+    limit := input.ResultLimit
+    showFares := input.ShowFares
+    showEmissions := input.ShowEmissions
+    switch input.OutputFormat {
+    case OUTPUT_TABLE:
+        return TableRenderer{ Limit: limit, ShowFares: showFares,
+            ShowEmissions: showEmissions }
+    case OUTPUT_MARKDOWN:
+        return MarkdownRenderer{ Limit: limit, ShowFares: showFares,
+            ShowEmissions: showEmissions }
+    case OUTPUT_HTML:
+        return HTMLRenderer{ Limit: limit, ShowFares: showFares,
+            ShowEmissions: showEmissions }
+    case OUTPUT_JSON:
+        return JSONRenderer{}
+    case OUTPUT_NDJSON:
+        return NDJSONRenderer{}
+    case OUTPUT_CSV:
+        return CSVRenderer{}
+    case OUTPUT_BROWSE:
+        return BrowserRenderer{}
+    default:
+        return CardRenderer{ Limit: limit, ShowFares: showFares,
+            ShowEmissions: showEmissions, Loyalty: input.Ranking.Loyalty }
+    }
+}
+
+func GetResultLimit(limit int) int {
+    if limit > 0 {
+        return limit
+    }
+    return DEFAULT_RESULT_LIMIT
+}
+
+/**
+ * Compact layout: one line per option.
+ */
+type TableRenderer struct {
+    Limit int
+    ShowFares bool
+    ShowEmissions bool
+}
+
+func (r TableRenderer) Render(w io.Writer, summary SearchSummary,
+    optionsList FlightsResultOptionList) error {
+
+    costFont := color.New(color.FgYellow, color.Bold)
+    buf := new(bytes.Buffer)
+
+    PrintSummary(buf, summary)
+    for i := 0; i < Min(len(optionsList), GetResultLimit(r.Limit)); i++ {
+        option := optionsList[i]
+        fmt.Fprintf(buf, "%3d  ", i+1)
+        costFont.Fprintf(buf, "%9s", fmt.Sprintf("$%.2f", option.Price))
+        fmt.Fprintf(buf, "  %s  |  %s",
+            DescribeSlice(option.Slices[0]), DescribeSlice(option.Slices[1]))
+        if option.BagFees > 0 {
+            fmt.Fprintf(buf, "  |  %s", DescribeBagFees(option))
+        }
+        if r.ShowFares {
+            fmt.Fprintf(buf, "  |  %s", DescribeFare(option))
+        }
+        if r.ShowEmissions {
+            fmt.Fprintf(buf, "  |  %s", DescribeEmissions(option))
+        }
+        fmt.Fprintln(buf)
+    }
+
+    _, err := buf.WriteTo(w)
+    return err
+
+}
+
+/**
+ * A Markdown table, for pasting into chat or issues.
+ */
+type MarkdownRenderer struct {
+    Limit int
+    ShowFares bool
+    ShowEmissions bool
+}
+
+func (r MarkdownRenderer) Render(w io.Writer, summary SearchSummary,
+    optionsList FlightsResultOptionList) error {
+
+    buf := new(bytes.Buffer)
+
+    fmt.Fprintf(buf, "**%d/%d queries returned successfully.**\n\n",
+        summary.Successes, summary.AttemptedRequests)
+    for _,warning := range summary.Warnings {
+        fmt.Fprintf(buf, "- Warning: %s\n", warning)
+    }
+    if len(summary.Warnings) > 0 {
+        fmt.Fprintln(buf)
+    }
+    header, rule := "| # | Price | Outbound | Inbound |", "|---|------:|----------|---------|"
+    if r.ShowFares {
+        header, rule = header + " Fare |", rule + "------|"
+    }
+    if r.ShowEmissions {
+        header, rule = header + " Emissions |", rule + "-----------|"
+    }
+    fmt.Fprintln(buf, header)
+    fmt.Fprintln(buf, rule)
+    for i := 0; i < Min(len(optionsList), GetResultLimit(r.Limit)); i++ {
+        option := optionsList[i]
+        price := fmt.Sprintf("$%.2f", option.Price)
+        if option.BagFees > 0 {
+            price += " (" + DescribeBagFees(option) + ")"
+        }
+        fmt.Fprintf(buf, "| %d | %s | %s | %s |", i+1, price,
+            EscapeMarkdownCell(DescribeSlice(option.Slices[0])),
+            EscapeMarkdownCell(DescribeSlice(option.Slices[1])))
+        if r.ShowFares {
+            fmt.Fprintf(buf, " %s |", EscapeMarkdownCell(DescribeFare(option)))
+        }
+        if r.ShowEmissions {
+            fmt.Fprintf(buf, " %s |", EscapeMarkdownCell(DescribeEmissions(option)))
+        }
+        fmt.Fprintln(buf)
+    }
+
+    _, err := buf.WriteTo(w)
+    return err
+
+}
+
+func EscapeMarkdownCell(text string) string {
+    return strings.Replace(text, "|", "\\|", -1)
+}
+
+/**
+ * A single HTML page with inline styles, so it can be mailed or archived
+ *     on its own.
+ */
+type HTMLRenderer struct {
+    Limit int
+    ShowFares bool
+    ShowEmissions bool
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(
+    template.FuncMap{
+        "datetime": func(t time.Time, airport string) string {
+            return InAirportTime(t, airport).Format("Mon Jan 02 03:04 PM MST")
+        },
+        "duration": FormatDuration,
+        "stops": DescribeSegmentStops,
+        "fare": DescribeFare,
+        "bags": DescribeBagFees,
+        "distance": DescribeSliceDistance,
+        "inc": func(i int) int { return i + 1 },
+    }).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Flight Search Results</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+.summary { font-weight: bold; }
+.ok { color: #2a7a2a; }
+.error { color: #b22; }
+.option { border: 1px solid #ccc; border-radius: 4px; margin: 1em 0; padding: 0.5em 1em; max-width: 40em; }
+.price { color: #b8860b; font-size: 1.3em; font-weight: bold; }
+.slice { border-top: 1px solid #eee; padding: 0.5em 0; }
+.direction { display: inline-block; width: 6em; font-weight: bold; }
+.route { color: #177; font-weight: bold; }
+.detail { color: #177; }
+.warning { color: #b22; font-weight: bold; }
+.holiday { color: #a3a; font-weight: bold; }
+.fare { color: #555; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>Flight Search Results</h1>
+{{if eq .Summary.Successes .Summary.AttemptedRequests}}
+<p class="summary ok">All {{.Summary.Successes}} queries returned successfully!</p>
+{{else}}
+<p class="summary error">Errors! Only {{.Summary.Successes}}/{{.Summary.AttemptedRequests}} queries returned successfully.</p>
+{{end}}
+{{range .Summary.Warnings}}<p class="fare">Warning: {{.}}</p>
+{{end}}
+{{range $i, $option := .Options}}
+<div class="option">
+<div>#{{inc $i}} <span class="price">${{printf "%.2f" $option.Price}}</span></div>
+{{if gt $option.BagFees 0.0}}<div class="fare">With bags: {{bags $option}}</div>{{end}}
+{{if $.ShowFares}}<div class="fare">{{fare $option}}</div>{{end}}
+{{range $j, $slice := $option.Slices}}
+<div class="slice">
+<span class="direction">{{if eq $j 0}}Outbound{{else}}Inbound{{end}}</span>
+<span class="detail">{{duration $slice.Duration}}</span>
+{{range $slice.Segments}}
+<div><span class="route">{{.Origin}} &rarr; {{.Destination}}</span>
+<span class="detail">{{.FlightNumber}} ({{.Airline}}){{with .OperatingCarrier}}, operated by {{.}}{{end}}</span></div>
+<div class="detail">{{datetime .DepartureTime .Origin}} &ndash; {{datetime .ArrivalTime .Destination}}</div>
+{{with stops .}}<div class="warning">Stops: {{.}}</div>{{else}}{{if gt .NumLegs 1}}<div class="warning">Multiple Legs: {{.NumLegs}}</div>{{end}}{{end}}
+{{end}}
+{{if $.ShowEmissions}}<div class="fare">Distance: {{distance $slice}}</div>{{end}}
+{{if $slice.DateTags}}<div class="holiday">Holiday: {{range $k, $tag := $slice.DateTags}}{{if $k}}, {{end}}{{$tag}}{{end}}</div>{{end}}
+</div>
+{{end}}
+</div>
+{{end}}
+</body>
+</html>
+`))
+
+func (r HTMLRenderer) Render(w io.Writer, summary SearchSummary,
+    optionsList FlightsResultOptionList) error {
+
+    data := struct {
+        Summary SearchSummary
+        Options FlightsResultOptionList
+        ShowFares bool
+        ShowEmissions bool
+    }{
+        Summary: summary,
+        Options: optionsList[:Min(len(optionsList), GetResultLimit(r.Limit))],
+        ShowFares: r.ShowFares,
+        ShowEmissions: r.ShowEmissions,
+    }
+
+    buf := new(bytes.Buffer)
+    if err := htmlReportTemplate.Execute(buf, data); err != nil {
+        return err
+    }
+    _, err := buf.WriteTo(w)
+    return err
+
+}
+
+/**
+ * One-line description of a slice, e.g.
+ *     SFO -> ORD Wed 03/29 08:00 AM - 01:00 PM, UA 1, 5h00m, nonstop
+ */
+func DescribeSlice(slice FlightsResultSlice) string {
+
+    const DATETIME_FMT = "Mon 01/02 03:04 PM"
+    const TIME_FMT = "03:04 PM"
+
+    if len(slice.Segments) == 0 {
+        return ""
+    }
+    first := slice.Segments[0]
+    last := slice.Segments[len(slice.Segments)-1]
+    departure := InAirportTime(first.DepartureTime, first.Origin)
+    arrival := InAirportTime(last.ArrivalTime, last.Destination)
+
+    var flightNumbers []string
+    for _,segment := range slice.Segments {
+        flightNumbers = append(flightNumbers, segment.FlightNumber)
+    }
+
+    arrivalFmt := TIME_FMT
+    if arrival.YearDay() != departure.YearDay() {
+        arrivalFmt = DATETIME_FMT
+    }
+
+    description := fmt.Sprintf("%s -> %s %s - %s, %s, %s, %s",
+        first.Origin, last.Destination,
+        departure.Format(DATETIME_FMT),
+        arrival.Format(arrivalFmt),
+        strings.Join(flightNumbers, "/"),
+        FormatDuration(slice.Duration),
+        DescribeStops(slice.GetStops()))
+    if len(slice.DateTags) > 0 {
+        description += " [" + strings.Join(slice.DateTags, ", ") + "]"
+    }
+    return description
+
+}
+
+/**
+ * One-line fare breakdown, e.g.
+ *     base $246.51 + taxes $69.89, fare basis KA7NA0MN, booking K/K,
+ *     nonrefundable, 1 free bag
+ */
+func DescribeFare(option FlightsResultOption) string {
+
+    fare := option.Fare
+    if !fare.HasPricing {
+        return "no fare breakdown"
+    }
+
+    details := []string{
+        fmt.Sprintf("base $%.2f + taxes $%.2f", fare.BaseFare, fare.Taxes),
+    }
+    if len(fare.FareBasis) > 0 {
+        details = append(details, "fare basis " + strings.Join(fare.FareBasis, "/"))
+    }
+    if codes := option.GetBookingCodes(); len(codes) > 0 {
+        details = append(details, "booking " + strings.Join(codes, "/"))
+    }
+    if fare.Refundable {
+        details = append(details, "refundable")
+    } else {
+        details = append(details, "nonrefundable")
+    }
+    details = append(details, DescribeFreeBags(fare.FreeBags))
+    return strings.Join(details, ", ")
+
+}
+
+// Booking class of each segment, in travel order
+func (option FlightsResultOption) GetBookingCodes() (codes []string) {
+    for _,slice := range option.Slices {
+        for _,segment := range slice.Segments {
+            if len(segment.BookingCode) > 0 {
+                codes = append(codes, segment.BookingCode)
+            }
+        }
+    }
+    return
+}
+
+// Expected Output Format: $386.40 incl. $70.00 bag fees
+func DescribeBagFees(option FlightsResultOption) string {
+    return fmt.Sprintf("$%.2f incl. $%.2f bag fees", option.GetEffectivePrice(),
+        option.BagFees)
+}
+
+func DescribeFreeBags(bags int) string {
+    switch bags {
+    case 0:
+        return "no free bags"
+    case 1:
+        return "1 free bag"
+    default:
+        return fmt.Sprintf("%d free bags", bags)
+    }
+}
+
+// Every leg after the first is a stop, whether or not the flight number changes
+func (slice FlightsResultSlice) GetStops() int {
+    stops := -1
+    for _,segment := range slice.Segments {
+        stops += segment.NumLegs
+    }
+    return stops
+}
+
+func DescribeStops(stops int) string {
+    switch stops {
+    case 0:
+        return "nonstop"
+    case 1:
+        return "1 stop"
+    default:
+        return fmt.Sprintf("%d stops", stops)
+    }
+}
+
+func FormatDuration(d time.Duration) string {
+    return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes()) % 60)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+    "time"
+)
+
+// The export options, flown at times QPX gave in UTC
+func GetRendererTestOptions() FlightsResultOptionList {
+    options := GetExportTestOptions()
+    segment := &options[0].Slices[0].Segments[0]
+    segment.DepartureTime = time.Date(2017, time.March, 29, 15, 0, 0, 0, time.UTC)
+    segment.ArrivalTime = time.Date(2017, time.March, 29, 17, 30, 0, 0, time.UTC)
+    segment.OperatingCarrier = "SkyWest <Express> & Co"
+    return options
+}
+
+func TestDescribeSliceInAirportTime(t *testing.T) {
+    want := "SFO -> DEN Wed 03/29 08:00 AM - 11:30 AM, UA 100, 0h00m, nonstop [Thanksgiving]"
+    if got := DescribeSlice(GetRendererTestOptions()[0].Slices[0]); got != want {
+        t.Errorf("got %q, want %q", got, want)
+    }
+}
+
+func TestHTMLRenderer(t *testing.T) {
+
+    buf := new(bytes.Buffer)
+    summary := SearchSummary{ AttemptedRequests: 3, Successes: 2,
+        Warnings: []string{ "<b>bold</b>" } }
+    err := HTMLRenderer{ Limit: 1, ShowFares: true }.Render(buf, summary,
+        GetRendererTestOptions())
+    if err != nil {
+        t.Fatal(err)
+    }
+    html := buf.String()
+
+    for _,expected := range []string{
+        "Errors! Only 2/3 queries returned successfully.",
+        "Warning: &lt;b&gt;bold&lt;/b&gt;",
+        `#1 <span class="price">$300.00</span>`,
+        "With bags: $360.00 incl. $60.00 bag fees",
+        "fare basis KA7NA0MN",
+        "operated by SkyWest &lt;Express&gt; &amp; Co",
+        "Wed Mar 29 08:00 AM PDT &ndash; Wed Mar 29 11:30 AM MDT",
+        "Holiday: Thanksgiving",
+    } {
+        if !strings.Contains(html, expected) {
+            t.Errorf("report is missing %q:\n%s", expected, html)
+        }
+    }
+    if strings.Contains(html, "#2 ") || strings.Contains(html, "<b>") {
+        t.Errorf("report has more than one option or unescaped text:\n%s", html)
+    }
+
+}
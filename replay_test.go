@@ -0,0 +1,133 @@
+package main
+
+import (
+    "io/ioutil"
+    "os"
+    "strings"
+    "testing"
+    "github.com/fatih/color"
+)
+
+// Recordings in the format RecordDir saves, one per request below. These are
+//     synthetic: written by hand in the shape QPX responds with rather than
+//     captured from it, so the flights and fares are made up.
+const REPLAY_DIR = "testdata/replay"
+
+// Searched from both Bay Area airports, with an option in the OAK response
+//     that's missing its inbound slice
+func GetReplayInput() InputParams {
+    return InputParams{
+        OriginAirports: []string{ "SFO", "OAK" },
+        DestAirport: "BOS",
+        ReturnAirports: RETURN_MIRROR,
+        Outbound: DirectionParams{ Date: "2017-03-29" },
+        Inbound: DirectionParams{ Date: "2017-04-02" },
+        NumPassengers: 1,
+        CheckedBags: 1,
+    }
+}
+
+// Everything written to stdout while f runs, including through color
+func CaptureStdout(t *testing.T, f func()) string {
+
+    r, w, err := os.Pipe()
+    if err != nil {
+        t.Fatal(err)
+    }
+    stdout, colorOutput := os.Stdout, color.Output
+    os.Stdout, color.Output = w, w
+    defer func() { os.Stdout, color.Output = stdout, colorOutput }()
+
+    output := make(chan string)
+    go func() {
+        data, _ := ioutil.ReadAll(r)
+        output <- string(data)
+    }()
+    f()
+    w.Close()
+    return <-output
+
+}
+
+func TestReplaySearch(t *testing.T) {
+
+    input := GetReplayInput()
+    config := AppConfig{ ReplayDir: REPLAY_DIR }
+
+    reqList := BuildFlightRequest(input, nil)
+    if len(reqList) != 2 {
+        t.Fatalf("built %d requests, want 2", len(reqList))
+    }
+    resList := MakeParallelQPXRequests(reqList, config)
+    if err := CheckReplayResults(resList); err != nil {
+        t.Fatal(err)
+    }
+
+    options, successes := FlattenResponses(resList, input.Ranking)
+    if successes != 2 || len(options) != 3 {
+        t.Fatalf("got %d options from %d responses, want 3 from 2", len(options), successes)
+    }
+    // Still the cheapest once a $25 bag fee each way is added
+    if options[0].Slices[0].Segments[0].FlightNumber != "B6 434" {
+        t.Errorf("cheapest option is %s", DescribeSlice(options[0].Slices[0]))
+    }
+    if basis := options[0].Fare.FareBasis; len(basis) != 1 || basis[0] != "OH0AUEN1" {
+        t.Errorf("got fare basis %q from the fare calculation, want OH0AUEN1", basis)
+    }
+    warnings := CollectWarnings(resList)
+    if len(warnings) != 1 || !strings.Contains(warnings[0], "OAK -> BOS") {
+        t.Errorf("got warnings %q, want one for the OAK response", warnings)
+    }
+
+    color.NoColor = true
+    output := CaptureStdout(t, func() {
+        PrintResults(options, len(resList), successes)
+    })
+    for _,expected := range []string{
+        "All 2 queries returned successfully!",
+        "Cost:       $289.00",
+        "Flight:     UA 100 (United Airlines, Inc.), operated by SkyWest Airlines",
+        "Stops:      DEN (0h45m)",
+        "Departure:  Wed Mar 29 09:00 AM PDT",
+    } {
+        if !strings.Contains(output, expected) {
+            t.Errorf("output is missing %q:\n%s", expected, output)
+        }
+    }
+
+}
+
+func TestReplayFailsOnUnmatchedRequest(t *testing.T) {
+
+    input := GetReplayInput()
+    input.Inbound.Date = "2017-04-04"
+    config := AppConfig{ ReplayDir: REPLAY_DIR }
+
+    resList, err := RunSearch(input, nil, config)
+    if err == nil || !strings.Contains(err.Error(), "no recording") {
+        t.Fatalf("got error %v, want one for the missing recording", err)
+    }
+    if len(resList) != 2 {
+        t.Errorf("got %d results, want one for each request", len(resList))
+    }
+
+}
+
+// SFO to BOS returning on the 3rd was recorded as a QPX backend error
+func TestReplayRecordedFailure(t *testing.T) {
+
+    input := GetReplayInput()
+    input.OriginAirports = []string{ "SFO" }
+    input.Inbound.Date = "2017-04-03"
+    config := AppConfig{ ReplayDir: REPLAY_DIR }
+
+    resList, err := RunSearch(input, nil, config)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(resList) != 1 || resList[0].Success ||
+        !strings.HasPrefix(resList[0].Error, "QPX error: backendError") {
+        t.Errorf("got results %+v, want the recorded QPX error", resList)
+    }
+
+}
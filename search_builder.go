@@ -6,23 +6,64 @@ import(
 	"os"
 	"math"
 	"strings"
+	"regexp"
+	"github.com/StephensAndrewM/FlightFinder/refdata"
 	// "github.com/davecgh/go-spew/spew"
 )
 
+// Which inbound airports may be paired with the outbound ones
+const (
+	RETURN_ANY     = "any"     // Inbound may differ from outbound at both ends
+	RETURN_ONE_END = "one-end" // Inbound may differ at one end only
+	RETURN_MIRROR  = "mirror"  // Inbound must retrace the outbound airports
+)
+
 type InputParams struct {
 	OriginAirport    string
 	OriginAirports []string
 	DestAirport      string
 	DestAirports   []string
+	ReturnAirports string
 
 	Outbound DirectionParams	
 	Inbound DirectionParams
 
 	NumPassengers int
+	CheckedBags int // Per passenger
+	CarryOnBags int // Per passenger, not counting a personal item
 	MinTripLength int
 	MaxTripLength int
+
+	CalendarFile string
+	HolidayMode string
+	HolidayBufferDays int
+
+	// Newer copies of the embedded reference data, in the same CSV format
+	AirportsFile string
+	AirlinesFile string
+
+	QueryBudget int
+	BudgetStrategy string
+
+	SearchMode string
+	CoarseStep int
+	RefineCount int
+
+	Ranking RankingParams
+
+	OutputFormat string
+	ResultLimit int
+	ShowFares bool
+	ShowEmissions bool // Distance, detour and CO2 estimates
+	MatrixCSVFile string
+
 	DryRun bool
 	CacheOK bool
+	HistoryFile string
+
+	// Save QPX traffic as fixtures, or serve the search only from them
+	RecordDir string
+	ReplayDir string
 }
 
 type DirectionParams struct {
@@ -36,6 +77,118 @@ type DirectionParams struct {
 	TimeRange [2]string
 }
 
+/**
+ * Check the input for mistakes that would otherwise stop the program partway
+ *     through a search.
+ */
+func (input InputParams) Validate() (error) {
+
+	if len(input.GetOriginAirports()) == 0 {
+		return fmt.Errorf("no origin airport given")
+	}
+	if len(input.GetDestAirports()) == 0 {
+		return fmt.Errorf("no destination airport given")
+	}
+	if input.NumPassengers < 1 {
+		return fmt.Errorf("number of passengers must be at least 1")
+	}
+	if input.CheckedBags < 0 || input.CarryOnBags < 0 {
+		return fmt.Errorf("number of bags can't be negative")
+	}
+	if err := input.Outbound.ValidateDates(); err != nil {
+		return fmt.Errorf("outbound: %s", err)
+	}
+	if err := input.Inbound.ValidateDates(); err != nil {
+		return fmt.Errorf("inbound: %s", err)
+	}
+	if len(input.CalendarFile) > 0 {
+		if _, err := os.Stat(input.CalendarFile); err != nil {
+			return fmt.Errorf("calendar file: %s", err)
+		}
+	}
+	switch input.HolidayMode {
+	case "", HOLIDAYS_TAG, HOLIDAYS_EXCLUDE, HOLIDAYS_PREFER:
+	default:
+		return fmt.Errorf("unknown holiday mode: %q", input.HolidayMode)
+	}
+	switch input.ReturnAirports {
+	case "", RETURN_ANY, RETURN_ONE_END, RETURN_MIRROR:
+	default:
+		return fmt.Errorf("unknown return airports: %q", input.ReturnAirports)
+	}
+	switch input.SearchMode {
+	case "", SEARCH_FULL, SEARCH_INCREMENTAL:
+	default:
+		return fmt.Errorf("unknown search mode: %q", input.SearchMode)
+	}
+	switch input.BudgetStrategy {
+	case "", BUDGET_REFUSE, BUDGET_SAMPLE, BUDGET_PRIORITIZE:
+	default:
+		return fmt.Errorf("unknown budget strategy: %q", input.BudgetStrategy)
+	}
+	switch input.OutputFormat {
+	case "", OUTPUT_TEXT, OUTPUT_TABLE, OUTPUT_MARKDOWN, OUTPUT_HTML, OUTPUT_MATRIX,
+		OUTPUT_JSON, OUTPUT_NDJSON, OUTPUT_CSV, OUTPUT_BROWSE:
+	default:
+		return fmt.Errorf("unknown output format: %q", input.OutputFormat)
+	}
+	for _,airport := range input.GetAllAirports() {
+		if !airportCodeFormat.MatchString(airport) {
+			return fmt.Errorf("not an airport code: %q", airport)
+		}
+	}
+	return nil
+
+}
+
+var airportCodeFormat = regexp.MustCompile(`^[A-Z]{3}$`)
+
+/**
+ * Airports in the input that aren't in the reference data. These may still
+ *     be searched, but are more likely a typo.
+ */
+func (input InputParams) GetUnknownAirports() (unknown []string) {
+	for _,airport := range input.GetAllAirports() {
+		if _, ok := refdata.LookupAirport(airport); !ok {
+			unknown = append(unknown, airport)
+		}
+	}
+	return
+}
+
+func (direction DirectionParams) ValidateDates() (error) {
+
+	const DATE_FMT = "2006-01-02"
+	var dates []string
+	if len(direction.Date) > 0 {
+		dates = []string{ direction.Date }
+	} else if len(direction.Dates) > 0 {
+		dates = direction.Dates
+	} else {
+		dates = direction.DateRange[:]
+	}
+
+	for _,d := range dates {
+		if _, err := time.Parse(DATE_FMT, d); err != nil {
+			return fmt.Errorf("could not interpret date: %q", d)
+		}
+	}
+	return nil
+
+}
+
+func (input InputParams) GetHistoryFile() (string) {
+	if len(input.HistoryFile) > 0 {
+		return input.HistoryFile
+	}
+	return DEFAULT_HISTORY_FILE
+}
+
+func (input InputParams) GetAllAirports() (airports []string) {
+	airports = append(airports, input.GetOriginAirports()...)
+	return append(airports, input.GetDestAirports()...)
+}
+
 func (input InputParams) GetOriginAirports() ([]string) {
 	if len(input.OriginAirport) > 0 {
         return []string{ input.OriginAirport }
@@ -52,7 +205,36 @@ func (input InputParams) GetDestAirports() ([]string) {
     }
 }
 
-func (input InputParams) GetValidDateRanges() ([][]time.Time) {
+/**
+ * Whether the inbound slice may use these airports, given the outbound ones.
+ */
+func (input InputParams) AllowsReturnAirports(outboundOrigin, outboundDest,
+	inboundOrigin, inboundDest string) (bool) {
+
+	mismatches := 0
+	if inboundOrigin != outboundDest {
+		mismatches++
+	}
+	if inboundDest != outboundOrigin {
+		mismatches++
+	}
+
+	switch input.ReturnAirports {
+	case RETURN_MIRROR:
+		return mismatches == 0
+	case RETURN_ONE_END:
+		return mismatches <= 1
+	default:
+		return true
+	}
+
+}
+
+/**
+ * Every date pair the input allows, after applying the calendar. The calendar
+ *     may be nil if the input doesn't name one.
+ */
+func (input InputParams) GetValidDateRanges(cal *Calendar) ([][]time.Time) {
 
 	var possibleOutboundDates, possibleInboundDates []time.Time
 
@@ -104,8 +286,57 @@ func (input InputParams) GetValidDateRanges() ([][]time.Time) {
         }
     }
 
-    return ranges
+    return input.ApplyCalendar(cal, ranges)
+
+}
+
+/**
+ * Remove date pairs that conflict with the calendar file, if one is given.
+ */
+func (input InputParams) ApplyCalendar(cal *Calendar, ranges [][]time.Time) (
+	[][]time.Time) {
+
+	if cal == nil {
+		return ranges
+	}
+
+	var allowed, nearHoliday [][]time.Time
+	for _,dateRange := range ranges {
+		if cal.OverlapsBlackout(dateRange[0], dateRange[1]) {
+			continue
+		}
+		isNearHoliday := len(input.GetDateTags(cal, dateRange[0])) > 0 ||
+			len(input.GetDateTags(cal, dateRange[1])) > 0
+		if input.HolidayMode == HOLIDAYS_EXCLUDE && isNearHoliday {
+			continue
+		}
+		if isNearHoliday {
+			nearHoliday = append(nearHoliday, dateRange)
+		}
+		allowed = append(allowed, dateRange)
+	}
+
+	if input.HolidayMode == HOLIDAYS_PREFER && len(nearHoliday) > 0 {
+		return nearHoliday
+	}
+	return allowed
+
+}
+
+// The input's calendar file, or nil if it doesn't name one
+func (input InputParams) LoadCalendar() (*Calendar, error) {
+	if len(input.CalendarFile) == 0 {
+		return nil, nil
+	}
+	cal, err := LoadCalendar(input.CalendarFile)
+	if err != nil {
+		return nil, fmt.Errorf("calendar file: %s", err)
+	}
+	return cal, nil
+}
 
+func (input InputParams) GetDateTags(cal *Calendar, d time.Time) ([]string) {
+	return cal.GetHolidayTags(d, input.HolidayBufferDays)
 }
 
 func DateListToTimeList(dates []string) (validDates []time.Time) {
@@ -135,7 +366,7 @@ func DateStringToTime(dateStr string) (time.Time) {
 	const DATE_FMT = "2006-01-02"
 	d, err := time.Parse(DATE_FMT, dateStr)
 	if err != nil {
-		fmt.Printf("Could not interpret date: %s\n", dateStr)
+		fmt.Fprintf(os.Stderr, "Could not interpret date: %s\n", dateStr)
 		os.Exit(1)
 	}
 	return d
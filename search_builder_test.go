@@ -0,0 +1,25 @@
+package main
+
+import (
+    "testing"
+)
+
+func TestValidateOptions(t *testing.T) {
+
+    if err := GetReplayInput().Validate(); err != nil {
+        t.Fatal(err)
+    }
+    for name,setOption := range map[string]func(*InputParams){
+        "return airports": func(input *InputParams) { input.ReturnAirports = "mirrored" },
+        "search mode": func(input *InputParams) { input.SearchMode = "fast" },
+        "budget strategy": func(input *InputParams) { input.BudgetStrategy = "cheapest" },
+        "output format": func(input *InputParams) { input.OutputFormat = "xml" },
+    } {
+        input := GetReplayInput()
+        setOption(&input)
+        if err := input.Validate(); err == nil {
+            t.Errorf("unknown %s was accepted", name)
+        }
+    }
+
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+const DEFAULT_SERVER_ADDR = ":8080"
+
+const (
+    JOB_RUNNING = "running"
+    JOB_DONE    = "done"
+    JOB_FAILED  = "failed"
+)
+
+// Finished jobs are forgotten after this long, and no more than MAX_JOBS are
+//     kept at once
+const JOB_RETENTION = time.Hour
+const MAX_JOBS = 100
+
+// Job event types, alongside the PROGRESS_ types passed through from the search
+const (
+    JOB_EVENT_CREATED    = "created"
+    JOB_EVENT_BEST_PRICE = "best_price"
+)
+
+/**
+ * Runs searches on behalf of other tools. Every search shares this process's
+ *     response cache and QPX rate limit, and the server's own calendar file.
+ */
+type SearchServer struct {
+    config AppConfig
+    calendarFile string
+    jobs map[string]*SearchJob
+    lock sync.Mutex
+}
+
+type SearchJob struct {
+    ID string                   `json:"id"`
+    Status string               `json:"status"`
+    CreatedAt time.Time         `json:"created_at"`
+    FinishedAt *time.Time       `json:"finished_at,omitempty"`
+    Error string                `json:"error,omitempty"`
+    Completed int               `json:"completed"`
+    Total int                   `json:"total"`
+    BestOption *ExportOption    `json:"best_option,omitempty"`
+    Results *ExportResults      `json:"results,omitempty"`
+
+    events []JobEvent
+    updated chan struct{}       // Closed and replaced whenever an event is added
+}
+
+/**
+ * One step of a background search, as sent to /jobs/{id}/events. Seq counts
+ *     up from 1 so a reconnecting client can skip what it has already seen.
+ */
+type JobEvent struct {
+    Seq int                     `json:"seq"`
+    Type string                 `json:"type"`
+    Time time.Time              `json:"time"`
+    Request string              `json:"request,omitempty"`
+    Reason string               `json:"reason,omitempty"`
+    Completed int               `json:"completed"`
+    Total int                   `json:"total"`
+    BestOption *ExportOption    `json:"best_option,omitempty"`
+}
+
+type ServerError struct {
+    Error string                `json:"error"`
+}
+
+func NewSearchServer(config AppConfig, calendarFile string) (*SearchServer) {
+    config.CacheOK = true
+    return &SearchServer{
+        config: config,
+        calendarFile: calendarFile,
+        jobs: make(map[string]*SearchJob),
+    }
+}
+
+func RunServerCommand(args []string, config AppConfig) {
+
+    addr := DEFAULT_SERVER_ADDR
+    if len(args) > 0 {
+        addr = args[0]
+    }
+
+    server := NewSearchServer(config, Input.CalendarFile)
+    fmt.Fprintf(os.Stderr, "Listening on %s\n", addr)
+    if err := http.ListenAndServe(addr, server.Handler()); err != nil {
+        fmt.Fprintf(os.Stderr, "Server stopped: %s\n", err)
+        os.Exit(1)
+    }
+
+}
+
+/**
+ * GET  /                   Web UI for composing searches and browsing results
+ * POST /search             Run an InputParams document, respond when it's done
+ * POST /jobs               Start an InputParams document in the background
+ * GET  /jobs/{id}          Status of a background search, with results once done
+ * GET  /jobs/{id}/events   Progress of a background search as Server-Sent Events
+ */
+func (s *SearchServer) Handler() (http.Handler) {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/search", s.HandleSearch)
+    mux.HandleFunc("/jobs", s.HandleCreateJob)
+    mux.HandleFunc("/jobs/", s.HandleGetJob)
+    mux.Handle("/", WebUIHandler())
+    return mux
+}
+
+func (s *SearchServer) HandleSearch(w http.ResponseWriter, r *http.Request) {
+
+    if r.Method != http.MethodPost {
+        WriteServerError(w, http.StatusMethodNotAllowed, "use POST")
+        return
+    }
+    input, cal, ok := s.ReadSearchInput(w, r)
+    if !ok {
+        return
+    }
+
+    results, err := s.RunSearch(input, cal, nil)
+    if err != nil {
+        WriteServerError(w, http.StatusUnprocessableEntity, err.Error())
+        return
+    }
+    WriteServerJSON(w, http.StatusOK, results)
+
+}
+
+func (s *SearchServer) HandleCreateJob(w http.ResponseWriter, r *http.Request) {
+
+    if r.Method != http.MethodPost {
+        WriteServerError(w, http.StatusMethodNotAllowed, "use POST")
+        return
+    }
+    input, cal, ok := s.ReadSearchInput(w, r)
+    if !ok {
+        return
+    }
+
+    job := &SearchJob{
+        ID: NewJobID(),
+        Status: JOB_RUNNING,
+        CreatedAt: time.Now(),
+        updated: make(chan struct{}),
+    }
+    s.lock.Lock()
+    s.expireJobs(job.CreatedAt)
+    if len(s.jobs) >= MAX_JOBS {
+        s.lock.Unlock()
+        WriteServerError(w, http.StatusServiceUnavailable,
+            fmt.Sprintf("already keeping %d jobs, try again later", MAX_JOBS))
+        return
+    }
+    s.jobs[job.ID] = job
+    s.addJobEvent(job, JobEvent{ Type: JOB_EVENT_CREATED })
+    snapshot := *job
+    s.lock.Unlock()
+
+    go func() {
+        results, err := s.RunSearch(input, cal, func(event ProgressEvent) {
+            s.lock.Lock()
+            defer s.lock.Unlock()
+            s.recordProgress(job, input.Ranking, event)
+        })
+        finishedAt := time.Now()
+
+        s.lock.Lock()
+        defer s.lock.Unlock()
+        job.FinishedAt = &finishedAt
+        if err != nil {
+            job.Status = JOB_FAILED
+            job.Error = err.Error()
+            s.addJobEvent(job, JobEvent{ Type: JOB_FAILED, Reason: job.Error })
+        } else {
+            job.Status = JOB_DONE
+            job.Results = &results
+            s.addJobEvent(job, JobEvent{ Type: JOB_DONE })
+        }
+    }()
+
+    w.Header().Set("Location", "/jobs/" + job.ID)
+    WriteServerJSON(w, http.StatusAccepted, snapshot)
+
+}
+
+func (s *SearchServer) HandleGetJob(w http.ResponseWriter, r *http.Request) {
+
+    if r.Method != http.MethodGet {
+        WriteServerError(w, http.StatusMethodNotAllowed, "use GET")
+        return
+    }
+
+    id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+    if strings.HasSuffix(id, "/events") {
+        s.HandleJobEvents(w, r, strings.TrimSuffix(id, "/events"))
+        return
+    }
+    s.lock.Lock()
+    job, ok := s.jobs[id]
+    var snapshot SearchJob
+    if ok {
+        snapshot = *job
+    }
+    s.lock.Unlock()
+
+    if !ok {
+        WriteServerError(w, http.StatusNotFound, "no such job: " + id)
+        return
+    }
+    WriteServerJSON(w, http.StatusOK, snapshot)
+
+}
+
+/**
+ * Replay a job's events so far, then stream new ones as they happen. The
+ *     stream ends after the job finishes or the client goes away. A client
+ *     reconnecting with Last-Event-ID only gets the events it missed.
+ */
+func (s *SearchServer) HandleJobEvents(w http.ResponseWriter, r *http.Request,
+    id string) {
+
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        WriteServerError(w, http.StatusInternalServerError, "streaming not supported")
+        return
+    }
+
+    s.lock.Lock()
+    job, ok := s.jobs[id]
+    s.lock.Unlock()
+    if !ok {
+        WriteServerError(w, http.StatusNotFound, "no such job: " + id)
+        return
+    }
+
+    // Anything that isn't the id of an event we've sent starts from the top
+    sent := 0
+    if lastID, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil {
+        s.lock.Lock()
+        if lastID > 0 && lastID <= len(job.events) {
+            sent = lastID
+        }
+        s.lock.Unlock()
+    }
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.WriteHeader(http.StatusOK)
+    flusher.Flush()
+
+    for {
+        s.lock.Lock()
+        var pending []JobEvent
+        if sent < len(job.events) {
+            pending = job.events[sent:]
+        }
+        finished := job.Status != JOB_RUNNING
+        updated := job.updated
+        s.lock.Unlock()
+
+        for _,event := range pending {
+            if err := WriteServerEvent(w, event); err != nil {
+                return
+            }
+            sent = event.Seq
+        }
+        flusher.Flush()
+        if finished {
+            return
+        }
+
+        select {
+        case <-updated:
+        case <-r.Context().Done():
+            return
+        }
+    }
+
+}
+
+// Forget jobs that finished more than JOB_RETENTION ago. Callers must hold s.lock.
+func (s *SearchServer) expireJobs(now time.Time) {
+    for id,job := range s.jobs {
+        if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > JOB_RETENTION {
+            delete(s.jobs, id)
+        }
+    }
+}
+
+// Callers must hold s.lock
+func (s *SearchServer) addJobEvent(job *SearchJob, event JobEvent) {
+    event.Seq = len(job.events) + 1
+    event.Time = time.Now()
+    event.Completed = job.Completed
+    event.Total = job.Total
+    job.events = append(job.events, event)
+    close(job.updated)
+    job.updated = make(chan struct{})
+}
+
+/**
+ * Turn a search's progress into job events. A finished request that beats
+ *     the best price so far gets a best_price event of its own, so clients
+ *     can show early results. Like the final results, only options the
+ *     ranking allows count, priced with bag fees. Callers must hold s.lock.
+ */
+func (s *SearchServer) recordProgress(job *SearchJob, ranking RankingParams,
+    event ProgressEvent) {
+
+    switch event.Type {
+    case PROGRESS_PLANNED:
+        // Incremental searches plan more than one batch
+        job.Total += event.Total
+        s.addJobEvent(job, JobEvent{ Type: event.Type })
+
+    case PROGRESS_STARTED:
+        s.addJobEvent(job, JobEvent{
+            Type: event.Type,
+            Request: DescribeRequest(event.Request),
+        })
+
+    case PROGRESS_SUCCEEDED, PROGRESS_FAILED:
+        job.Completed++
+        s.addJobEvent(job, JobEvent{
+            Type: event.Type,
+            Request: DescribeRequest(event.Request),
+            Reason: event.Result.Error,
+        })
+
+        improved := false
+        for _,option := range event.Result.Options {
+            if !ranking.Allows(option) {
+                continue
+            }
+            if job.BestOption == nil ||
+                option.GetEffectivePrice() < job.BestOption.EffectivePrice {
+                best := NewExportOption(1, option)
+                job.BestOption = &best
+                improved = true
+            }
+        }
+        if improved {
+            s.addJobEvent(job, JobEvent{
+                Type: JOB_EVENT_BEST_PRICE,
+                BestOption: job.BestOption,
+            })
+        }
+    }
+
+}
+
+/**
+ * Same pipeline as the command line: search, save to history, rank. Progress
+ *     may be nil.
+ */
+func (s *SearchServer) RunSearch(input InputParams, cal *Calendar,
+    progress ProgressFunc) (results ExportResults, err error) {
+
+    config := s.config
+    config.DryRun = config.DryRun || input.DryRun
+    config.Progress = progress
+
+    resList, err := RunSearch(input, cal, config)
+    if err != nil {
+        return
+    }
+    if !config.DryRun {
+        SaveRun(input, resList, config)
+    }
+
+    options, successes := FlattenResponses(resList, input.Ranking)
+    summary := SearchSummary{
+        AttemptedRequests: len(resList),
+        Successes: successes,
+        Warnings: CollectWarnings(resList),
+    }
+    return NewExportResults(summary, options), nil
+
+}
+
+/**
+ * Decode and validate the posted InputParams, and load the server's calendar
+ *     for it. Unknown fields are rejected, so a misspelled option isn't
+ *     silently ignored, as are fields naming files or directories on the
+ *     server.
+ */
+func (s *SearchServer) ReadSearchInput(w http.ResponseWriter, r *http.Request) (
+    input InputParams, cal *Calendar, ok bool) {
+
+    decoder := json.NewDecoder(r.Body)
+    decoder.DisallowUnknownFields()
+    if err := decoder.Decode(&input); err != nil {
+        WriteServerError(w, http.StatusBadRequest, "invalid InputParams: " + err.Error())
+        return
+    }
+    if fields := input.GetPathFields(); len(fields) > 0 {
+        WriteServerError(w, http.StatusBadRequest, "invalid input: " +
+            strings.Join(fields, ", ") + " can't be set through the server")
+        return
+    }
+    input.CalendarFile = s.calendarFile
+    if err := input.Validate(); err != nil {
+        WriteServerError(w, http.StatusBadRequest, "invalid input: " + err.Error())
+        return
+    }
+    cal, err := input.LoadCalendar()
+    if err != nil {
+        WriteServerError(w, http.StatusBadRequest, "invalid input: " + err.Error())
+        return
+    }
+    return input, cal, true
+
+}
+
+// Names of the fields that are set to a file or directory path
+func (input InputParams) GetPathFields() (fields []string) {
+    for _,field := range []struct {
+        name, value string
+    }{
+        { "CalendarFile", input.CalendarFile },
+        { "AirportsFile", input.AirportsFile },
+        { "AirlinesFile", input.AirlinesFile },
+        { "MatrixCSVFile", input.MatrixCSVFile },
+        { "HistoryFile", input.HistoryFile },
+        { "RecordDir", input.RecordDir },
+        { "ReplayDir", input.ReplayDir },
+    } {
+        if len(field.value) > 0 {
+            fields = append(fields, field.name)
+        }
+    }
+    return
+}
+
+func WriteServerJSON(w http.ResponseWriter, status int, body interface{}) {
+    w.Header().Set("Content-Type", JSON_TYPE)
+    w.WriteHeader(status)
+    encoder := json.NewEncoder(w)
+    encoder.SetIndent("", "  ")
+    if err := encoder.Encode(body); err != nil {
+        fmt.Fprintf(os.Stderr, "Error writing response: %s\n", err)
+    }
+}
+
+func WriteServerError(w http.ResponseWriter, status int, message string) {
+    WriteServerJSON(w, status, ServerError{ Error: message })
+}
+
+func WriteServerEvent(w io.Writer, event JobEvent) error {
+    data, err := json.Marshal(event)
+    if err != nil {
+        return err
+    }
+    _, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq,
+        event.Type, data)
+    return err
+}
+
+// Expected Output Format: SFO -> BOS 2017-05-26, BOS -> SFO 2017-05-29
+func DescribeRequest(req FlightsRequest) string {
+    var slices []string
+    for _,slice := range req.Slices {
+        slices = append(slices, fmt.Sprintf("%s -> %s %s", slice.Origin,
+            slice.Destination, slice.Date.Format("2006-01-02")))
+    }
+    return strings.Join(slices, ", ")
+}
+
+func NewJobID() string {
+    id := make([]byte, 8)
+    if _, err := rand.Read(id); err != nil {
+        return fmt.Sprintf("%x", time.Now().UnixNano())
+    }
+    return hex.EncodeToString(id)
+}
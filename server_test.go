@@ -0,0 +1,64 @@
+package main
+
+import (
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+// A finished job with the given events, registered with a new server
+func NewServerTestJob(events ...JobEvent) (*SearchServer, *SearchJob) {
+    s := NewSearchServer(AppConfig{}, "")
+    job := &SearchJob{ ID: "job", Status: JOB_RUNNING, updated: make(chan struct{}) }
+    s.jobs[job.ID] = job
+    for _,event := range events {
+        s.addJobEvent(job, event)
+    }
+    job.Status = JOB_DONE
+    return s, job
+}
+
+func TestJobEventsLastEventID(t *testing.T) {
+
+    s, _ := NewServerTestJob(JobEvent{ Type: JOB_EVENT_CREATED },
+        JobEvent{ Type: PROGRESS_PLANNED }, JobEvent{ Type: JOB_DONE })
+    for lastID,want := range map[string]int{
+        "": 3,
+        "2": 1,
+        "3": 0,
+        "-3": 3,
+        "99": 3,
+        "abc": 3,
+    } {
+        r := httptest.NewRequest("GET", "/jobs/job/events", nil)
+        r.Header.Set("Last-Event-ID", lastID)
+        w := httptest.NewRecorder()
+        s.Handler().ServeHTTP(w, r)
+        if got := strings.Count(w.Body.String(), "\nevent: "); got != want {
+            t.Errorf("Last-Event-ID %q: got %d events, want %d", lastID, got, want)
+        }
+    }
+
+}
+
+func TestRecordProgressBestPrice(t *testing.T) {
+
+    s, job := NewServerTestJob()
+    options := GetBrowserTestOptions()
+    options[0].Price, options[0].EffectivePrice = 150, 150
+    options[1].BagFees, options[1].EffectivePrice = 60, 260
+    ranking := RankingParams{ BlockedAirlines: []string{ "UA" } }
+
+    s.recordProgress(job, ranking, ProgressEvent{
+        Type: PROGRESS_SUCCEEDED,
+        Result: FlightsResult{ Success: true, Options: options },
+    })
+    if job.BestOption == nil || job.BestOption.EffectivePrice != 260 {
+        t.Fatalf("got best option %+v, want the Alaska one at $260", job.BestOption)
+    }
+    last := job.events[len(job.events)-1]
+    if last.Type != JOB_EVENT_BEST_PRICE || last.BestOption.EffectivePrice != 260 {
+        t.Errorf("last event is %+v, want a best price of $260", last)
+    }
+
+}
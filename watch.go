@@ -0,0 +1,246 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "time"
+)
+
+const DEFAULT_WATCH_INTERVAL = time.Hour * 6
+
+// How often the daemon checks whether any watch is due
+const DAEMON_TICK = time.Minute
+
+const QUERY_LOG_SCHEMA = `
+CREATE TABLE IF NOT EXISTS query_log (
+    day TEXT PRIMARY KEY,
+    queries INTEGER NOT NULL
+);
+`
+
+/**
+ * A saved search that the daemon re-runs on an interval. An alert fires when
+ *     the cheapest option first drops to TargetPrice, or falls by at least
+ *     DropPercent since the previous run. Either threshold may be left zero.
+ *
+ * Prices include bag fees, and only options the ranking allows count.
+ */
+type Watch struct {
+    Name string
+    Input InputParams
+    TargetPrice float64
+    DropPercent float64
+    Interval time.Duration
+    Notifiers []Notifier
+}
+
+type DaemonParams struct {
+    DailyQueryBudget int
+    CacheTTL time.Duration
+}
+
+type Alert struct {
+    WatchName string
+    Reason string
+    Option FlightsResultOption
+    PreviousPrice float64
+    HasPreviousPrice bool
+}
+
+func (watch Watch) GetInterval() time.Duration {
+    if watch.Interval > 0 {
+        return watch.Interval
+    }
+    return DEFAULT_WATCH_INTERVAL
+}
+
+/**
+ * Decide whether the cheapest option of a new run should raise an alert. The
+ *     previous price is the best one RecordFares saved for the last run.
+ */
+func (watch Watch) CheckAlert(cheapest FlightsResultOption, previousPrice float64,
+    hasPreviousPrice bool) (alert Alert, fire bool) {
+
+    alert = Alert{
+        WatchName: watch.Name,
+        Option: cheapest,
+        PreviousPrice: previousPrice,
+        HasPreviousPrice: hasPreviousPrice,
+    }
+
+    price := cheapest.GetEffectivePrice()
+
+    // Only alert on crossing the target, not on every run below it
+    if watch.TargetPrice > 0 && price <= watch.TargetPrice &&
+        (!hasPreviousPrice || previousPrice > watch.TargetPrice) {
+        alert.Reason = fmt.Sprintf("Price $%.2f is at or below target $%.2f",
+            price, watch.TargetPrice)
+        return alert, true
+    }
+
+    if watch.DropPercent > 0 && hasPreviousPrice &&
+        price <= previousPrice*(1-watch.DropPercent/100) {
+        alert.Reason = fmt.Sprintf("Price dropped %.0f%% from $%.2f to $%.2f",
+            (1-price/previousPrice)*100, previousPrice, price)
+        return alert, true
+    }
+
+    return alert, false
+
+}
+
+/**
+ * Re-run every watch in input.go on its interval, until killed.
+ */
+func RunDaemonCommand(config AppConfig) {
+
+    if len(Watches) == 0 {
+        fmt.Fprintln(os.Stderr, "No watches defined in input.go")
+        os.Exit(1)
+    }
+
+    config.CacheOK = true
+    config.CacheTTL = Daemon.CacheTTL
+    nextRuns := make(map[string]time.Time)
+    ticker := time.NewTicker(DAEMON_TICK)
+    defer ticker.Stop()
+
+    for {
+        for _,watch := range Watches {
+            if time.Now().Before(nextRuns[watch.Name]) {
+                continue
+            }
+            RunWatch(watch, config)
+            nextRuns[watch.Name] = time.Now().Add(watch.GetInterval())
+        }
+        <-ticker.C
+    }
+
+}
+
+/**
+ * Run a watch's search once, save it, and alert if it crossed a threshold.
+ *     Skipped if it would go over the daily query budget.
+ */
+func RunWatch(watch Watch, config AppConfig) {
+
+    fmt.Fprintf(os.Stderr, "%s: Running watch %s\n",
+        time.Now().Format(time.RFC3339), watch.Name)
+
+    history, err := OpenHistory(config.HistoryFile)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Could not open history database: %s\n", err)
+        return
+    }
+    defer history.Close()
+
+    cal, err := watch.Input.LoadCalendar()
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Watch %s: %s\n", watch.Name, err)
+        return
+    }
+    reqList, withinBudget := ApplyQueryBudget(BuildFlightRequest(watch.Input, cal),
+        watch.Input, config)
+    if !withinBudget {
+        fmt.Fprintf(os.Stderr, "Watch %s exceeds its query budget of %d, skipping\n",
+            watch.Name, watch.Input.QueryBudget)
+        return
+    }
+
+    plan := PlanQueries(reqList, config)
+    plan.Print()
+    newQueries := plan.NumRequests - plan.CachedRequests
+    today := time.Now().Format("2006-01-02")
+    if Daemon.DailyQueryBudget > 0 {
+        used, err := history.GetQueriesUsed(today)
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Could not read query log: %s\n", err)
+            return
+        }
+        if used + newQueries > Daemon.DailyQueryBudget {
+            fmt.Fprintf(os.Stderr,
+                "Watch %s needs %d queries but only %d of %d remain today, skipping\n",
+                watch.Name, newQueries, Daemon.DailyQueryBudget - used,
+                Daemon.DailyQueryBudget)
+            return
+        }
+    }
+
+    previousPrice, hasPreviousPrice, err := history.GetLatestBestPrice(
+        watch.Input.GetSearchKey())
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Could not read fare history: %s\n", err)
+        return
+    }
+
+    resList, err := SendQPXRequests(reqList, config)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Watch %s failed: %s\n", watch.Name, err)
+        return
+    }
+    if !config.DryRun {
+        if err := history.AddQueriesUsed(today, newQueries); err != nil {
+            fmt.Fprintf(os.Stderr, "Could not update query log: %s\n", err)
+        }
+        SaveRun(watch.Input, resList, config)
+    }
+
+    options, _ := FlattenResponses(resList, watch.Input.Ranking)
+    if len(options) == 0 {
+        return
+    }
+    if alert, fire := watch.CheckAlert(GetCheapestOption(options), previousPrice,
+        hasPreviousPrice); fire {
+        SendAlert(alert, watch.Notifiers)
+    }
+
+}
+
+// The option with the lowest price including bag fees, whatever the ranking
+func GetCheapestOption(options FlightsResultOptionList) (cheapest FlightsResultOption) {
+    for i,option := range options {
+        if i == 0 || option.GetEffectivePrice() < cheapest.GetEffectivePrice() {
+            cheapest = option
+        }
+    }
+    return
+}
+
+/**
+ * Cheapest fare recorded by the most recent run of a search.
+ */
+func (h *History) GetLatestBestPrice(searchKey string) (
+    price float64, ok bool, err error) {
+
+    if _, err = h.db.Exec(FARES_SCHEMA); err != nil {
+        return
+    }
+    row := h.db.QueryRow(`SELECT MIN(price) FROM fares WHERE search_key = ?
+        AND run_id = (SELECT MAX(run_id) FROM fares WHERE search_key = ?)`,
+        searchKey, searchKey)
+    var best *float64
+    if err = row.Scan(&best); err != nil || best == nil {
+        return
+    }
+    return *best, true, nil
+
+}
+
+func (h *History) GetQueriesUsed(day string) (queries int, err error) {
+    if _, err = h.db.Exec(QUERY_LOG_SCHEMA); err != nil {
+        return
+    }
+    err = h.db.QueryRow("SELECT COALESCE(SUM(queries), 0) FROM query_log WHERE day = ?",
+        day).Scan(&queries)
+    return
+}
+
+func (h *History) AddQueriesUsed(day string, queries int) (err error) {
+    if _, err = h.db.Exec(QUERY_LOG_SCHEMA); err != nil {
+        return
+    }
+    _, err = h.db.Exec(`INSERT INTO query_log (day, queries) VALUES (?, ?)
+        ON CONFLICT(day) DO UPDATE SET queries = queries + excluded.queries`,
+        day, queries)
+    return
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+    "embed"
+    "io/fs"
+    "net/http"
+)
+
+// The browser front end, built into the binary so the server has no files
+//     to deploy alongside it
+//go:embed web
+var webFiles embed.FS
+
+/**
+ * Serves the single page UI. It only talks to the JSON endpoints, the same
+ *     as any other client would.
+ */
+func WebUIHandler() (http.Handler) {
+    root, err := fs.Sub(webFiles, "web")
+    if err != nil {
+        panic(err)
+    }
+    return http.FileServer(http.FS(root))
+}